@@ -0,0 +1,57 @@
+package otp
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time to TOTP keys and verifiers.
+type Clock interface {
+	Now() time.Time
+}
+
+// clock backed by time.Now
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the Clock used when none is set.
+var SystemClock Clock = systemClock{}
+
+// FakeClock is a Clock that only moves when told to. It's safe for concurrent use.
+type FakeClock struct {
+	mtx sync.Mutex
+	t   time.Time
+}
+
+// NewFakeClock creates a *FakeClock set to t.
+func NewFakeClock(t time.Time) *FakeClock { return &FakeClock{t: t} }
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.t
+}
+
+// Set sets the clock to t.
+func (c *FakeClock) Set(t time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.t = t
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// return c, or SystemClock if c is nil
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
@@ -0,0 +1,37 @@
+package otp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	c := NewFakeClock(time.Unix(100, 0))
+	if !c.Now().Equal(time.Unix(100, 0)) {
+		t.Error("got the wrong time")
+		return
+	}
+	c.Advance(time.Minute)
+	if !c.Now().Equal(time.Unix(160, 0)) {
+		t.Error("got the wrong time")
+		return
+	}
+	c.Set(time.Unix(0, 0))
+	if !c.Now().Equal(time.Unix(0, 0)) {
+		t.Error("got the wrong time")
+		return
+	}
+	if clockOrSystem(nil) != SystemClock || clockOrSystem(c) != c {
+		t.Error("got the wrong clock")
+		return
+	}
+	// keys with their own clocks don't interfere with each other
+	k1, _ := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	k2, _ := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	k1.Clock = NewFakeClock(time.Unix(30, 0))
+	k2.Clock = NewFakeClock(time.Unix(60, 0))
+	if k1.Code() != 848969 || k2.Code() != 292828 {
+		t.Error("got the wrong code")
+		return
+	}
+}
@@ -0,0 +1,224 @@
+package otp
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Enroller defaults.
+const (
+	// Time the user has to confirm a pending key.
+	DefaultEnrollTimeout = 10 * time.Minute
+)
+
+// prefixes of the store ids holding pending and active keys
+const (
+	pendingPrefix = "pending:"
+	keyPrefix     = "key:"
+)
+
+// stored pending key
+type pendingData struct {
+	Key     []byte    `json:"key"`
+	Expires time.Time `json:"expires"`
+}
+
+// Enroller activates keys only once the user proves they have them, by
+// submitting a valid code. New keys are kept as pending in the Store, and
+// moved to the active keys when confirmed before they expire.
+type Enroller struct {
+	// Store for the pending and active keys, and the state of the active keys.
+	Store Store
+	// Encrypter, if not nil, seals the stored keys with SealKey.
+	// nil, the keys are stored in the clear, in the binary encoding.
+	Encrypter KeyEncrypter
+	// Time to confirm a pending key. <= 0, defaults to DefaultEnrollTimeout.
+	Timeout time.Duration
+	// Window of accepted steps for the confirmation code. HOTP keys only use Ahead.
+	Opts *VerifyOpts
+	// Clock for the expiry and the TOTP codes. nil, defaults to SystemClock.
+	Clock Clock
+}
+
+// NewEnroller creates an *Enroller.
+func NewEnroller(s Store) *Enroller { return &Enroller{Store: s} }
+
+// Begin stores k as the pending key of id, replacing any previous pending key,
+// and returns its otpauth url, to show to the user or encode in a QR code.
+// The active key of id, if any, is kept until k is confirmed.
+func (e *Enroller) Begin(id string, k Key) (string, error) {
+	b, err := e.encode(k)
+	if err != nil {
+		return "", err
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultEnrollTimeout
+	}
+	b, err = json.Marshal(&pendingData{b, clockOrSystem(e.Clock).Now().Add(timeout)})
+	if err != nil {
+		return "", &Error{ECStore, fmt.Sprintf("can't encode pending key: %v", err), err}
+	}
+	if err = e.put(pendingPrefix+id, b); err != nil {
+		return "", err
+	}
+	return k.Url(), nil
+}
+
+// BeginTotp creates a new TOTP key with the defaults and stores it as the pending key of id.
+func (e *Enroller) BeginTotp(id, label, issuer string) (*Totp, error) {
+	t, err := NewTotpWithDefaults(label, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = e.Begin(id, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Confirm checks code against the pending key of id and, if it matches,
+// makes it the active key of id and resets its verification state, so the
+// code can't be used again. It fails with ECNoEnrollment if there is no
+// pending key or it expired. It returns the activated key.
+func (e *Enroller) Confirm(id, code string) (Key, error) {
+	now := clockOrSystem(e.Clock).Now()
+	p, ver, err := e.pending(id)
+	if err != nil {
+		return nil, err
+	} else if p == nil || !now.Before(p.Expires) {
+		return nil, &Error{ECNoEnrollment, fmt.Sprintf("no pending enrollment for %q", id), nil}
+	}
+	k, err := e.decode(p.Key)
+	if err != nil {
+		return nil, err
+	}
+	st := &State{}
+	switch kk := k.(type) {
+	case *Hotp:
+		ahead := 0
+		if e.Opts != nil {
+			ahead = e.Opts.Ahead
+		}
+		if _, err = kk.Accept(code, ahead); err != nil {
+			return nil, err
+		}
+		st.Counter = kk.Counter
+	case *Totp:
+		if _, err = kk.Accept(code, now, e.Opts); err != nil {
+			return nil, err
+		}
+		st.LastStep, st.Used, st.Drift = kk.LastStep, kk.Used, kk.Drift
+	default:
+		return nil, &Error{ECInvalidOtpType, fmt.Sprintf("invalid OTP authentication type: %v", k.Type()), nil}
+	}
+	// remove the pending key first, it can only be confirmed once
+	if ok, err := e.Store.CompareAndSwap(pendingPrefix+id, ver, nil); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, &Error{ECNoEnrollment, fmt.Sprintf("the pending enrollment for %q changed", id), nil}
+	}
+	b, err := e.encode(k)
+	if err != nil {
+		return nil, err
+	}
+	if err = e.put(keyPrefix+id, b); err != nil {
+		return nil, err
+	}
+	for {
+		_, ver, err := LoadState(e.Store, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok, err := SwapState(e.Store, id, ver, st); err != nil {
+			return nil, err
+		} else if ok {
+			return k, nil
+		}
+	}
+}
+
+// Key returns the active key of id, nil if there is none.
+func (e *Enroller) Key(id string) (Key, error) {
+	b, _, err := e.Store.Load(keyPrefix + id)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return e.decode(b)
+}
+
+// Expire removes the pending keys that expired, and returns how many it removed.
+func (e *Enroller) Expire() (int, error) {
+	ids, err := e.Store.List(pendingPrefix)
+	if err != nil {
+		return 0, err
+	}
+	now := clockOrSystem(e.Clock).Now()
+	n := 0
+	for _, id := range ids {
+		p, ver, err := e.pending(id[len(pendingPrefix):])
+		if err != nil {
+			return n, err
+		} else if p == nil || now.Before(p.Expires) {
+			continue
+		}
+		// a new enrollment may have replaced it, leave it alone
+		if ok, err := e.Store.CompareAndSwap(id, ver, nil); err != nil {
+			return n, err
+		} else if ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// load the pending key of id, nil if there is none
+func (e *Enroller) pending(id string) (*pendingData, uint64, error) {
+	b, ver, err := e.Store.Load(pendingPrefix + id)
+	if err != nil || b == nil {
+		return nil, ver, err
+	}
+	p := &pendingData{}
+	if err = json.Unmarshal(b, p); err != nil {
+		return nil, 0, &Error{ECStore, fmt.Sprintf("can't decode pending key: %v", err), err}
+	}
+	return p, ver, nil
+}
+
+// store value under id, whatever its version
+func (e *Enroller) put(id string, value []byte) error {
+	for {
+		_, ver, err := e.Store.Load(id)
+		if err != nil {
+			return err
+		}
+		if ok, err := e.Store.CompareAndSwap(id, ver, value); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+	}
+}
+
+// encode a key for the store, sealed if there's an encrypter
+func (e *Enroller) encode(k Key) ([]byte, error) {
+	if e.Encrypter != nil {
+		return SealKey(k, e.Encrypter)
+	}
+	switch kk := k.(type) {
+	case *Totp:
+		return kk.MarshalBinary()
+	case *Hotp:
+		return kk.MarshalBinary()
+	}
+	return nil, &Error{ECInvalidOtpType, fmt.Sprintf("invalid OTP authentication type: %v", k.Type()), nil}
+}
+
+// decode a stored key
+func (e *Enroller) decode(b []byte) (Key, error) {
+	if e.Encrypter != nil {
+		return OpenKey(b, e.Encrypter)
+	}
+	return UnmarshalKeyBinary(b)
+}
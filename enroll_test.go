@@ -0,0 +1,157 @@
+package otp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEnroller(t *testing.T) {
+	s := NewMemoryStore()
+	clk := NewFakeClock(time.Unix(0, 0).Add(DefaultPeriod * 2))
+	e := &Enroller{Store: s, Clock: clk}
+	kt, err := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	u, err := e.Begin("alice", kt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if u != kt.Url() {
+		t.Error("expected", kt.Url(), "got", u)
+		return
+	}
+	// not active until confirmed
+	if k, err := e.Key("alice"); err != nil || k != nil {
+		t.Error("the key shouldn't be active:", k, err)
+		return
+	}
+	if _, err = e.Confirm("alice", "000000"); !checkError(err, ECInvalidCode) {
+		t.Error("expected ECInvalidCode, got", err)
+		return
+	}
+	k, err := e.Confirm("alice", "292828")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if k.Url() != kt.Url() {
+		t.Error("expected", kt.Url(), "got", k.Url())
+		return
+	}
+	if k, err := e.Key("alice"); err != nil || k == nil || k.Url() != kt.Url() {
+		t.Error("the key should be active:", k, err)
+		return
+	}
+	// confirmed once, and the code can't be replayed
+	if _, err = e.Confirm("alice", "292828"); !checkError(err, ECNoEnrollment) {
+		t.Error("expected ECNoEnrollment, got", err)
+		return
+	}
+	kt2, _ := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	v := &Verifier{Store: s, Clock: clk}
+	if _, err = v.Verify("alice", kt2, "292828"); !checkError(err, ECReplayed) {
+		t.Error("expected ECReplayed, got", err)
+		return
+	}
+	// hotp, with a look-ahead
+	e.Opts = &VerifyOpts{Ahead: 3}
+	kh, _ := ImportHotp("otpauth://hotp/myKey?counter=0&secret=5STMOV5AVXA2IYVU")
+	if _, err = e.Begin("bob", kh); err != nil {
+		t.Error(err)
+		return
+	}
+	if k, err = e.Confirm("bob", "801920"); err != nil {
+		t.Error(err)
+		return
+	}
+	if st, _, err := LoadState(s, "bob"); err != nil || st == nil || st.Counter != 2 || k.(*Hotp).Counter != 2 {
+		t.Error("the counter should be 2:", st, err)
+		return
+	}
+	// no enrollment
+	if _, err = e.Confirm("carol", "123456"); !checkError(err, ECNoEnrollment) {
+		t.Error("expected ECNoEnrollment, got", err)
+		return
+	}
+}
+
+func TestEnrollerExpire(t *testing.T) {
+	s := NewMemoryStore()
+	clk := NewFakeClock(time.Unix(0, 0).Add(DefaultPeriod * 2))
+	e := &Enroller{Store: s, Clock: clk, Timeout: time.Minute}
+	kt, _ := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	for _, id := range []string{"alice", "bob"} {
+		if _, err := e.Begin(id, kt); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	clk.Advance(30 * time.Second)
+	if _, err := e.BeginTotp("carol", "carol", "Example"); err != nil {
+		t.Error(err)
+		return
+	}
+	if n, err := e.Expire(); err != nil || n != 0 {
+		t.Error("nothing should expire:", n, err)
+		return
+	}
+	// a late confirmation fails, even with a valid code
+	clk.Advance(40 * time.Second)
+	if _, err := e.Confirm("alice", kt.CodePeriodString(kt.step(clk.Now()))); !checkError(err, ECNoEnrollment) {
+		t.Error("expected ECNoEnrollment, got", err)
+		return
+	}
+	if n, err := e.Expire(); err != nil || n != 2 {
+		t.Error("2 enrollments should expire:", n, err)
+		return
+	}
+	if ids, _ := s.List(pendingPrefix); len(ids) != 1 || ids[0] != pendingPrefix+"carol" {
+		t.Error("only carol should be pending:", ids)
+		return
+	}
+	clk.Advance(time.Minute)
+	if n, err := e.Expire(); err != nil || n != 1 {
+		t.Error("1 enrollment should expire:", n, err)
+		return
+	}
+}
+
+func TestEnrollerEncrypter(t *testing.T) {
+	enc, err := NewStaticKeyEncrypter("k1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s := NewMemoryStore()
+	clk := NewFakeClock(time.Unix(0, 0).Add(DefaultPeriod * 2))
+	e := &Enroller{Store: s, Encrypter: enc, Clock: clk}
+	kt, _ := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if _, err = e.Begin("alice", kt); err != nil {
+		t.Error(err)
+		return
+	}
+	if p, _, err := e.pending("alice"); err != nil {
+		t.Error(err)
+		return
+	} else if _, err = ParseKeyEnvelope(p.Key); err != nil {
+		t.Error("the pending key should be sealed:", err)
+		return
+	}
+	if _, err = e.Confirm("alice", "292828"); err != nil {
+		t.Error(err)
+		return
+	}
+	b, _, _ := s.Load(keyPrefix + "alice")
+	if env, err := ParseKeyEnvelope(b); err != nil || env.KeyID != "k1" {
+		t.Error("the active key should be sealed:", err)
+		return
+	}
+	if k, err := e.Key("alice"); err != nil || k.Url() != kt.Url() {
+		t.Error("can't open the active key:", err)
+		return
+	}
+}
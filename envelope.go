@@ -0,0 +1,290 @@
+package otp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// KeyEncrypter wraps and unwraps the data keys that encrypt key envelopes,
+// with key encryption keys (KEK) identified by a key ID.
+type KeyEncrypter interface {
+	// Wrap encrypts the data key dek and returns the ID of the KEK used.
+	Wrap(dek []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped with the KEK keyID.
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// envelope format
+var envelopeMagic = []byte("OTPE")
+
+const (
+	envelopeVersion = 1
+	// AES-256 data keys
+	dekSize = 32
+)
+
+// KeyEnvelope is the header of a sealed key. It's stored in the clear,
+// but authenticated along with the encrypted key.
+type KeyEnvelope struct {
+	// KeyID is the ID of the KEK that wrapped the data key.
+	KeyID string
+	// Issuer and AccountName of the sealed key.
+	Issuer      string
+	AccountName string
+	// wrapped data key and nonce
+	wrapped, nonce []byte
+	// encrypted key
+	ciphertext []byte
+	// authenticated header
+	ad []byte
+}
+
+// SealKey encrypts k with a new data key wrapped by e.
+// The label and issuer are authenticated, so envelopes can't be swapped between accounts.
+func SealKey(k Key, e KeyEncrypter) ([]byte, error) {
+	var (
+		c     *Common
+		plain []byte
+		err   error
+	)
+	switch kk := k.(type) {
+	case *Totp:
+		c = kk.Common
+		plain, err = kk.MarshalBinary()
+	case *Hotp:
+		c = kk.Common
+		plain, err = kk.MarshalBinary()
+	default:
+		return nil, &Error{ECInvalidOtpType, fmt.Sprintf("invalid OTP authentication type: %v", k.Type()), nil}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// keys that wouldn't open again
+	if err = c.validate(); err != nil {
+		return nil, err
+	}
+	dek := make([]byte, dekSize)
+	if _, err = rand.Read(dek); err != nil {
+		return nil, &Error{ECCantReadRandom, "error reading random bytes", err}
+	}
+	defer clear(dek)
+	id, wrapped, err := e.Wrap(dek)
+	if err != nil {
+		return nil, &Error{ECKeyEncrypter, "can't wrap the data key", err}
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, &Error{ECCantReadRandom, "error reading random bytes", err}
+	}
+	// header: magic, version, key id, wrapped data key, nonce, issuer and account name
+	b := append(append([]byte(nil), envelopeMagic...), envelopeVersion)
+	issuer, account := c.names()
+	for _, f := range [][]byte{[]byte(id), wrapped, nonce, []byte(issuer), []byte(account)} {
+		b = binary.AppendUvarint(b, uint64(len(f)))
+		b = append(b, f...)
+	}
+	return aead.Seal(b, nonce, plain, b), nil
+}
+
+// OpenKey decrypts a key sealed by SealKey, unwrapping the data key with e.
+func OpenKey(b []byte, e KeyEncrypter) (Key, error) {
+	env, err := ParseKeyEnvelope(b)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := e.Unwrap(env.KeyID, env.wrapped)
+	if err != nil {
+		return nil, &Error{ECKeyEncrypter, fmt.Sprintf("can't unwrap the data key with %q", env.KeyID), err}
+	}
+	defer clear(dek)
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.nonce) != aead.NonceSize() {
+		return nil, &Error{ECInvalidEnvelope, "invalid envelope nonce", nil}
+	}
+	plain, err := aead.Open(nil, env.nonce, env.ciphertext, env.ad)
+	if err != nil {
+		return nil, &Error{ECInvalidEnvelope, "can't decrypt the envelope", err}
+	}
+	defer clear(plain)
+	k, err := UnmarshalKeyBinary(plain)
+	if err != nil {
+		return nil, err
+	}
+	// the sealed key must match the authenticated header
+	var c *Common
+	switch kk := k.(type) {
+	case *Totp:
+		c = kk.Common
+	case *Hotp:
+		c = kk.Common
+	}
+	if c.Issuer != env.Issuer || c.AccountName != env.AccountName {
+		return nil, &Error{ECInvalidEnvelope, "the envelope header doesn't match the key", nil}
+	}
+	return k, nil
+}
+
+// ParseKeyEnvelope parses the header of a sealed key, without decrypting it.
+func ParseKeyEnvelope(b []byte) (*KeyEnvelope, error) {
+	bad := &Error{ECInvalidEnvelope, "invalid key envelope", nil}
+	if !bytes.HasPrefix(b, envelopeMagic) || len(b) <= len(envelopeMagic) {
+		return nil, bad
+	}
+	if v := b[len(envelopeMagic)]; v != envelopeVersion {
+		return nil, &Error{ECInvalidEnvelope, fmt.Sprintf("unsupported envelope version: %d", v), nil}
+	}
+	r := b[len(envelopeMagic)+1:]
+	var fields [5][]byte
+	for i := range fields {
+		l, n := binary.Uvarint(r)
+		if n <= 0 || uint64(len(r)-n) < l {
+			return nil, bad
+		}
+		fields[i], r = r[n:n+int(l)], r[n+int(l):]
+	}
+	return &KeyEnvelope{
+		KeyID:       string(fields[0]),
+		wrapped:     fields[1],
+		nonce:       fields[2],
+		Issuer:      string(fields[3]),
+		AccountName: string(fields[4]),
+		ciphertext:  r,
+		ad:          b[:len(b)-len(r)],
+	}, nil
+}
+
+// AES-256-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != dekSize {
+		return nil, &Error{ECKeyEncrypter, fmt.Sprintf("keys must be %d bytes, got %d", dekSize, len(key)), nil}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, &Error{ECKeyEncrypter, "can't create the cipher", err}
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, &Error{ECKeyEncrypter, "can't create the cipher", err}
+	}
+	return aead, nil
+}
+
+// StaticKeyEncrypter is a KeyEncrypter with a single, local, 32 byte KEK.
+type StaticKeyEncrypter struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewStaticKeyEncrypter creates a *StaticKeyEncrypter with the KEK kek, identified by id.
+func NewStaticKeyEncrypter(id string, kek []byte) (*StaticKeyEncrypter, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticKeyEncrypter{id, aead}, nil
+}
+
+// Wrap implements KeyEncrypter.
+func (s *StaticKeyEncrypter) Wrap(dek []byte) (string, []byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, &Error{ECCantReadRandom, "error reading random bytes", err}
+	}
+	// the key id is authenticated
+	return s.id, s.aead.Seal(nonce, nonce, dek, []byte(s.id)), nil
+}
+
+// Unwrap implements KeyEncrypter.
+func (s *StaticKeyEncrypter) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != s.id {
+		return nil, &Error{ECKeyEncrypter, fmt.Sprintf("unknown key id: %q", keyID), nil}
+	}
+	ns := s.aead.NonceSize()
+	if len(wrapped) < ns {
+		return nil, &Error{ECInvalidEnvelope, "invalid wrapped key", nil}
+	}
+	dek, err := s.aead.Open(nil, wrapped[:ns], wrapped[ns:], []byte(keyID))
+	if err != nil {
+		return nil, &Error{ECInvalidEnvelope, "can't unwrap the data key", err}
+	}
+	return dek, nil
+}
+
+// Keyring is a KeyEncrypter with several KEKs. The primary KEK wraps new
+// data keys, all of them unwrap, so old envelopes can be opened after a rotation.
+type Keyring struct {
+	primary string
+	keys    map[string]*StaticKeyEncrypter
+}
+
+// NewKeyring creates a *Keyring with the KEKs in keys, by ID. primary must be one of them.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	kr := &Keyring{primary, map[string]*StaticKeyEncrypter{}}
+	for id, kek := range keys {
+		s, err := NewStaticKeyEncrypter(id, kek)
+		if err != nil {
+			return nil, err
+		}
+		kr.keys[id] = s
+	}
+	if kr.keys[primary] == nil {
+		return nil, &Error{ECKeyEncrypter, fmt.Sprintf("missing primary key: %q", primary), nil}
+	}
+	return kr, nil
+}
+
+// keyring file
+type keyringFile struct {
+	Primary string            `json:"primary"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+// LoadKeyring reads a *Keyring from the JSON file at path, with the KEKs in base64:
+//
+//	{"primary": "2024", "keys": {"2023": "...", "2024": "..."}}
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &Error{ECKeyEncrypter, "can't read the keyring", err}
+	}
+	var f keyringFile
+	if err = json.Unmarshal(b, &f); err != nil {
+		return nil, &Error{ECKeyEncrypter, "can't parse the keyring", err}
+	}
+	return NewKeyring(f.Primary, f.Keys)
+}
+
+// Primary returns the ID of the KEK that wraps new data keys.
+func (kr *Keyring) Primary() string { return kr.primary }
+
+// Wrap implements KeyEncrypter, with the primary KEK.
+func (kr *Keyring) Wrap(dek []byte) (string, []byte, error) { return kr.keys[kr.primary].Wrap(dek) }
+
+// Unwrap implements KeyEncrypter, with any of the KEKs.
+func (kr *Keyring) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	s, ok := kr.keys[keyID]
+	if !ok {
+		return nil, &Error{ECKeyEncrypter, fmt.Sprintf("unknown key id: %q", keyID), nil}
+	}
+	return s.Unwrap(keyID, wrapped)
+}
+
+// ensure that we implement KeyEncrypter
+var (
+	_ KeyEncrypter = (*StaticKeyEncrypter)(nil)
+	_ KeyEncrypter = (*Keyring)(nil)
+)
@@ -0,0 +1,167 @@
+package otp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	kek := bytes.Repeat([]byte{1}, 32)
+	se, err := NewStaticKeyEncrypter("static", kek)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kt, err := ImportTotp("otpauth://totp/Example:alice?secret=ADS2OR6Q6K3OJZDW&issuer=Example&period=60")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kh, err := ImportHotp("otpauth://hotp/bob?secret=ADS2OR6Q6K3OJZDW&counter=9")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, v := range []struct {
+		k               Key
+		issuer, account string
+	}{{kt, "Example", "alice"}, {kh, "", "bob"}} {
+		k := v.k
+		b, err := SealKey(k, se)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if bytes.Contains(b, kt.Key) {
+			t.Error("the secret isn't encrypted")
+			return
+		}
+		env, err := ParseKeyEnvelope(b)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if env.KeyID != "static" || env.Issuer != v.issuer || env.AccountName != v.account {
+			t.Error("wrong envelope header:", env.KeyID, env.Issuer, env.AccountName)
+			return
+		}
+		k2, err := OpenKey(b, se)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if k2.Url() != k.Url() {
+			t.Error("wrong key:", k2.Url())
+			return
+		}
+	}
+	// tampering
+	b, err := SealKey(kt, se)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	swapped := bytes.Replace(b, []byte("alice"), []byte("malic"), 1)
+	for _, tb := range [][]byte{swapped, b[:len(b)-1], append(append([]byte(nil), b[:len(b)-1]...), b[len(b)-1]^1), []byte("OTPE"), []byte("XXXX\x01")} {
+		if _, err = OpenKey(tb, se); !errors.Is(err, ErrInvalidEnvelope) {
+			t.Error("got the wrong error:", err)
+			return
+		}
+	}
+	// wrong KEK
+	other, err := NewStaticKeyEncrypter("static", bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = OpenKey(b, other); !errors.Is(err, ErrKeyEncrypter) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	if _, err = NewStaticKeyEncrypter("short", kek[:16]); !checkError(err, ECKeyEncrypter) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	k1, k2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	p := filepath.Join(t.TempDir(), "keyring.json")
+	write := func(primary string, keys ...string) error {
+		return os.WriteFile(p, []byte(fmt.Sprintf(`{"primary": %q, "keys": {%s}}`, primary, strings.Join(keys, ", "))), 0600)
+	}
+	kv := func(id string, k []byte) string {
+		return fmt.Sprintf("%q: %q", id, base64.StdEncoding.EncodeToString(k))
+	}
+	if err := write("k1", kv("k1", k1)); err != nil {
+		t.Error(err)
+		return
+	}
+	old, err := LoadKeyring(p)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kt, err := ImportTotp("otpauth://totp/alice?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b, err := SealKey(kt, old)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// rotate, the old envelopes can still be opened
+	if err = write("k2", kv("k1", k1), kv("k2", k2)); err != nil {
+		t.Error(err)
+		return
+	}
+	kr, err := LoadKeyring(p)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if kr.Primary() != "k2" {
+		t.Error("wrong primary key:", kr.Primary())
+		return
+	}
+	if k, err := OpenKey(b, kr); err != nil {
+		t.Error(err)
+		return
+	} else if k.Url() != kt.Url() {
+		t.Error("wrong key:", k.Url())
+		return
+	}
+	if b, err = SealKey(kt, kr); err != nil {
+		t.Error(err)
+		return
+	}
+	if env, err := ParseKeyEnvelope(b); err != nil || env.KeyID != "k2" {
+		t.Error("wrong key id:", env, err)
+		return
+	}
+	if _, err = OpenKey(b, old); !checkError(err, ECKeyEncrypter) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	// bad keyrings
+	if err = write("k3", kv("k1", k1)); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = LoadKeyring(p); !checkError(err, ECKeyEncrypter) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	if _, err = LoadKeyring(p + ".missing"); !checkError(err, ECKeyEncrypter) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+}
@@ -0,0 +1,181 @@
+package otp
+
+import "fmt"
+
+// ErrorCode identifies the kind of an Error.
+type ErrorCode int
+
+// Error codes.
+const (
+	// Common errors for TOTP and HOTP.
+	ECMissingLabel     ErrorCode = iota // Missing (or empty) label.
+	ECInvalidAlgorithm                  // Invalid algorithm.
+	ECCantReadRandom                    // Something went wrong while reading random bytes.
+	ECNotEnoughRandom                   // Didn't read enough random bytes.
+	ECUrlParseError                     // Error parsing the url.
+	ECWrongScheme                       // Url scheme != "otpauth".
+	ECInvalidOtpType                    // Host in the url must be either "totp" or "hotp".
+	ECBase32Decoding                    // Base32 decoding error.
+	ECInvalidDigits                     // Invalid number of digits.
+	ECMissingSecret                     // Secret parameter is missing.
+
+	// HOTP specific errors.
+	ECNotHotp        // Url is not HOTP.
+	ECMissingCounter // Counter parameter is missing.
+	ECInvalidCounter // Can't parse counter.
+
+	// TOTP specific errors.
+	ECNotTotp       // Url is not TOTP.
+	ECInvalidPeriod // Can't parse period parameter.
+
+	// Verification errors.
+	ECInvalidCode  // The code doesn't match any step in the window.
+	ECResyncFailed // Couldn't find consecutive codes in the resync window.
+	ECReplayed     // The code's time step was already used.
+
+	// Storage errors.
+	ECStore // Error reading or writing the store.
+
+	// More TOTP specific errors.
+	ECInvalidT0 // Can't parse t0 parameter.
+
+	// OCRA specific errors.
+	ECInvalidOcraSuite // Can't parse the OCRA suite.
+	ECInvalidOcraInput // Missing or invalid OCRA input.
+
+	// Migration errors.
+	ECInvalidMigration // Invalid or unsupported migration payload.
+
+	// Label errors.
+	ECIssuerMismatch // The issuer prefix of the label and the issuer parameter differ.
+
+	// Marshalling errors.
+	ECInvalidEncoding // Invalid JSON or binary encoding of a key.
+
+	// Envelope errors.
+	ECInvalidEnvelope // Malformed or tampered key envelope.
+	ECKeyEncrypter    // The key encrypter failed, or doesn't have the key.
+
+	// Recovery codes errors.
+	ECInvalidRecoveryParams // Invalid recovery codes alphabet or scrypt parameters.
+
+	// Enrollment errors.
+	ECNoEnrollment // There's no pending enrollment, or it expired.
+
+	// Rate limiting errors.
+	ECLocked // Too many failed attempts, the key is locked out.
+
+	// More label errors.
+	ECInvalidLabel // The issuer or the account name contains a colon.
+)
+
+// Error is a common error struct returned by new/import functions.
+type Error struct {
+	// The field Code can hold any of the EC* error codes.
+	Code ErrorCode
+	// The field Desc is a description of the error.
+	Desc string
+	// The field Err holds the original error if any.
+	Err error
+}
+
+// Implement error.
+func (g *Error) Error() string {
+	var (
+		f = "%v"
+		a = []interface{}{g.Desc}
+	)
+	if g.Err != nil {
+		f += ": %v"
+		a = append(a, g.Err.Error())
+	}
+	return fmt.Sprintf(f, a...)
+}
+
+// Unwrap returns the original error, if any.
+func (g *Error) Unwrap() error { return g.Err }
+
+// Is reports whether target is an *Error with the same code,
+// so errors.Is(err, ErrMissingSecret) matches any error with the code ECMissingSecret.
+func (g *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == g.Code
+}
+
+// names of the error codes
+var errorCodeNames = map[ErrorCode]string{
+	ECMissingLabel:          "ECMissingLabel",
+	ECInvalidAlgorithm:      "ECInvalidAlgorithm",
+	ECCantReadRandom:        "ECCantReadRandom",
+	ECNotEnoughRandom:       "ECNotEnoughRandom",
+	ECUrlParseError:         "ECUrlParseError",
+	ECWrongScheme:           "ECWrongScheme",
+	ECInvalidOtpType:        "ECInvalidOtpType",
+	ECBase32Decoding:        "ECBase32Decoding",
+	ECInvalidDigits:         "ECInvalidDigits",
+	ECMissingSecret:         "ECMissingSecret",
+	ECNotHotp:               "ECNotHotp",
+	ECMissingCounter:        "ECMissingCounter",
+	ECInvalidCounter:        "ECInvalidCounter",
+	ECNotTotp:               "ECNotTotp",
+	ECInvalidPeriod:         "ECInvalidPeriod",
+	ECInvalidCode:           "ECInvalidCode",
+	ECResyncFailed:          "ECResyncFailed",
+	ECReplayed:              "ECReplayed",
+	ECStore:                 "ECStore",
+	ECInvalidT0:             "ECInvalidT0",
+	ECInvalidOcraSuite:      "ECInvalidOcraSuite",
+	ECInvalidOcraInput:      "ECInvalidOcraInput",
+	ECInvalidMigration:      "ECInvalidMigration",
+	ECIssuerMismatch:        "ECIssuerMismatch",
+	ECInvalidEncoding:       "ECInvalidEncoding",
+	ECInvalidEnvelope:       "ECInvalidEnvelope",
+	ECKeyEncrypter:          "ECKeyEncrypter",
+	ECInvalidRecoveryParams: "ECInvalidRecoveryParams",
+	ECNoEnrollment:          "ECNoEnrollment",
+	ECLocked:                "ECLocked",
+	ECInvalidLabel:          "ECInvalidLabel",
+}
+
+// String returns the name of the error code.
+func (c ErrorCode) String() string {
+	if n, ok := errorCodeNames[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int(c))
+}
+
+// Sentinel errors, one per error code, for errors.Is.
+var (
+	ErrMissingLabel          = &Error{ECMissingLabel, "missing (or empty) label", nil}
+	ErrInvalidAlgorithm      = &Error{ECInvalidAlgorithm, "invalid algorithm", nil}
+	ErrCantReadRandom        = &Error{ECCantReadRandom, "something went wrong while reading random bytes", nil}
+	ErrNotEnoughRandom       = &Error{ECNotEnoughRandom, "didn't read enough random bytes", nil}
+	ErrUrlParseError         = &Error{ECUrlParseError, "error parsing the url", nil}
+	ErrWrongScheme           = &Error{ECWrongScheme, "url scheme != \"otpauth\"", nil}
+	ErrInvalidOtpType        = &Error{ECInvalidOtpType, "host in the url must be either \"totp\" or \"hotp\"", nil}
+	ErrBase32Decoding        = &Error{ECBase32Decoding, "base32 decoding error", nil}
+	ErrInvalidDigits         = &Error{ECInvalidDigits, "invalid number of digits", nil}
+	ErrMissingSecret         = &Error{ECMissingSecret, "secret parameter is missing", nil}
+	ErrNotHotp               = &Error{ECNotHotp, "url is not HOTP", nil}
+	ErrMissingCounter        = &Error{ECMissingCounter, "counter parameter is missing", nil}
+	ErrInvalidCounter        = &Error{ECInvalidCounter, "can't parse counter", nil}
+	ErrNotTotp               = &Error{ECNotTotp, "url is not TOTP", nil}
+	ErrInvalidPeriod         = &Error{ECInvalidPeriod, "can't parse period parameter", nil}
+	ErrInvalidCode           = &Error{ECInvalidCode, "the code doesn't match any step in the window", nil}
+	ErrResyncFailed          = &Error{ECResyncFailed, "couldn't find consecutive codes in the resync window", nil}
+	ErrReplayed              = &Error{ECReplayed, "the code's time step was already used", nil}
+	ErrStore                 = &Error{ECStore, "error reading or writing the store", nil}
+	ErrInvalidT0             = &Error{ECInvalidT0, "can't parse t0 parameter", nil}
+	ErrInvalidOcraSuite      = &Error{ECInvalidOcraSuite, "can't parse the OCRA suite", nil}
+	ErrInvalidOcraInput      = &Error{ECInvalidOcraInput, "missing or invalid OCRA input", nil}
+	ErrInvalidMigration      = &Error{ECInvalidMigration, "invalid or unsupported migration payload", nil}
+	ErrIssuerMismatch        = &Error{ECIssuerMismatch, "the issuer prefix of the label and the issuer parameter differ", nil}
+	ErrInvalidEncoding       = &Error{ECInvalidEncoding, "invalid JSON or binary encoding of a key", nil}
+	ErrInvalidEnvelope       = &Error{ECInvalidEnvelope, "malformed or tampered key envelope", nil}
+	ErrKeyEncrypter          = &Error{ECKeyEncrypter, "the key encrypter failed, or doesn't have the key", nil}
+	ErrInvalidRecoveryParams = &Error{ECInvalidRecoveryParams, "invalid recovery codes alphabet or scrypt parameters", nil}
+	ErrNoEnrollment          = &Error{ECNoEnrollment, "there's no pending enrollment, or it expired", nil}
+	ErrLocked                = &Error{ECLocked, "too many failed attempts, the key is locked out", nil}
+	ErrInvalidLabel          = &Error{ECInvalidLabel, "the issuer or the account name contains a colon", nil}
+)
@@ -0,0 +1,47 @@
+package otp
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	_, err := ImportKey("otpauth://totp/alice?secret=A!S2OR6Q6K3OJZDW")
+	if !errors.Is(err, ErrBase32Decoding) || errors.Is(err, ErrMissingSecret) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	// the original error
+	var ce base32.CorruptInputError
+	if !errors.As(err, &ce) {
+		t.Error("can't reach the base32 error:", err)
+		return
+	}
+	var e *Error
+	if !errors.As(fmt.Errorf("wrapped: %w", err), &e) || e.Code != ECBase32Decoding {
+		t.Error("can't reach the otp error:", err)
+		return
+	}
+	if _, err = ImportKey("otpauth://totp/alice"); !errors.Is(err, ErrMissingSecret) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	// names
+	if s := ECMissingSecret.String(); s != "ECMissingSecret" {
+		t.Error("wrong name:", s)
+		return
+	}
+	if s := fmt.Sprint(ECIssuerMismatch, ErrorCode(-1)); s != "ECIssuerMismatch ErrorCode(-1)" {
+		t.Error("wrong names:", s)
+		return
+	}
+	// every code has a name
+	for c := ECMissingLabel; c <= ECInvalidLabel; c++ {
+		if _, ok := errorCodeNames[c]; !ok {
+			t.Error("missing name for", int(c))
+			return
+		}
+	}
+}
@@ -19,7 +19,7 @@ func Example() {
 		fmt.Println(err)
 		return
 	}
-	fmt.Println(k.Code(), k)
+	fmt.Println(k.Code(), k.Url())
 
 	// import key from url
 	k, err = otp.ImportKey("otpauth://totp/mydomain.com?secret=UYMIODYLDUSYMBVV")
@@ -28,7 +28,7 @@ func Example() {
 		return
 	}
 	kt := k.(*otp.Totp)
-	fmt.Println(kt.CodePeriod(0), kt)
+	fmt.Println(kt.CodePeriod(0), kt.Url())
 	// Output: 511108 otpauth://hotp/mydomain.com?counter=1&secret=UYMIODYLDUSYMBVV
 	// 453613 otpauth://totp/mydomain.com?secret=UYMIODYLDUSYMBVV
 }
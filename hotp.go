@@ -1,8 +1,10 @@
 package otp
 
 import (
+	"crypto/subtle"
 	"encoding/binary"
 	"fmt"
+	"log/slog"
 	"math"
 	"net/url"
 	"strconv"
@@ -32,6 +34,9 @@ func NewHotpWithDefaults(label, issuer string) (*Hotp, error) {
 	return NewHotp(0, label, issuer, "", 0, 0)
 }
 
+// parameters used by hotp keys
+var hotpParams = []string{"counter"}
+
 // import hotp key
 func importHotp(k *Common, params url.Values) (*Hotp, error) {
 	r := &Hotp{Common: k}
@@ -45,13 +50,21 @@ func importHotp(k *Common, params url.Values) (*Hotp, error) {
 	} else {
 		r.Counter = i
 	}
+	k.setParams(params, hotpParams...)
 	return r, nil
 }
 
 // ImportHotp imports an url in the otpauth format.
-func ImportHotp(u string) (*Hotp, error) {
+// Lowercase, unpadded, secrets with spaces or dashes are accepted.
+func ImportHotp(u string) (*Hotp, error) { return importHotpUrl(u, false) }
+
+// ImportHotpStrict imports an url in the otpauth format with a padded, uppercase, base32 secret.
+func ImportHotpStrict(u string) (*Hotp, error) { return importHotpUrl(u, true) }
+
+// import a hotp url
+func importHotpUrl(u string, strict bool) (*Hotp, error) {
 	// import url
-	k, t, p, err := importCommon(u)
+	k, t, p, err := importCommon(u, strict)
 	if err != nil {
 		return nil, err
 	}
@@ -64,11 +77,27 @@ func ImportHotp(u string) (*Hotp, error) {
 
 // Url returns the key in the otpauth format.
 func (h *Hotp) Url() string {
-	return h.url(TypeHotp, url.Values{"counter": []string{strconv.Itoa(h.Counter)}})
+	return h.url(TypeHotp, url.Values{"counter": []string{strconv.Itoa(h.Counter)}}, false)
 }
 
-// String returns the same as Url().
-func (h *Hotp) String() string { return h.Url() }
+// UrlPadded returns the same as Url(), with the secret padded, for apps that require it.
+func (h *Hotp) UrlPadded() string {
+	return h.url(TypeHotp, url.Values{"counter": []string{strconv.Itoa(h.Counter)}}, true)
+}
+
+// String returns the same as Url(), with the secret redacted.
+func (h *Hotp) String() string { return redactUrl(h.Url()) }
+
+// GoString returns the fields of the key with the secret redacted.
+func (h *Hotp) GoString() string {
+	return fmt.Sprintf("&otp.Hotp{Common:%#v, Counter:%d}", h.Common, h.Counter)
+}
+
+// LogValue implements slog.LogValuer, logging everything but the secret.
+func (h *Hotp) LogValue() slog.Value {
+	attrs := append([]slog.Attr{slog.String("type", TypeHotp)}, h.logAttrs()...)
+	return slog.GroupValue(append(attrs, slog.Int("counter", h.Counter))...)
+}
 
 // Code returns the current code.
 func (h *Hotp) Code() int { return h.codeCounter(h.Counter) }
@@ -79,6 +108,15 @@ func (h *Hotp) CodeN(n int) int { return h.codeCounter(h.Counter + n) }
 // CodeCounter returns the code for the counter c.
 func (h *Hotp) CodeCounter(c int) int { return h.codeCounter(c) }
 
+// CodeString returns the current code, zero padded to Digits.
+func (h *Hotp) CodeString() string { return h.CodeCounterString(h.Counter) }
+
+// CodeNString returns the code for counter+n, zero padded to Digits.
+func (h *Hotp) CodeNString(n int) string { return h.CodeCounterString(h.Counter + n) }
+
+// CodeCounterString returns the code for the counter c, zero padded to Digits.
+func (h *Hotp) CodeCounterString(c int) string { return formatCode(h.codeCounter(c), h.Digits) }
+
 // returns the code for counter c.
 func (h *Hotp) codeCounter(c int) int {
 	return int(binary.BigEndian.Uint32(h.hashTruncateInt(c))) % int(math.Pow10(h.Digits))
@@ -86,3 +124,38 @@ func (h *Hotp) codeCounter(c int) int {
 
 // Type returns TypeHotp
 func (h *Hotp) Type() string { return TypeHotp }
+
+// Verify checks code against the codes for the counters in the window around Counter.
+// It returns the offset, relative to Counter, of the matching counter.
+func (h *Hotp) Verify(code string, opts *VerifyOpts) (int, error) {
+	return verifyWindow(code, h.Counter, opts, h.CodeCounterString)
+}
+
+// Accept checks code against the counters Counter..Counter+ahead and, on success,
+// advances Counter past the matching counter. It returns the offset of the match.
+func (h *Hotp) Accept(code string, ahead int) (int, error) {
+	ofs, err := h.Verify(code, &VerifyOpts{Ahead: ahead})
+	if err != nil {
+		return 0, err
+	}
+	h.Counter += ofs + 1
+	return ofs, nil
+}
+
+// Resync implements the resynchronisation procedure from RFC 4226 section 7.4.
+// It looks for two consecutive codes, code1 and code2, in the counters
+// Counter..Counter+window and, if found, sets Counter past them.
+func (h *Hotp) Resync(code1, code2 string, window int) error {
+	code1, code2 = normalizeCode(code1), normalizeCode(code2)
+	next := h.CodeCounterString(h.Counter)
+	for c := h.Counter; c <= h.Counter+window; c++ {
+		cur := next
+		next = h.CodeCounterString(c + 1)
+		if subtle.ConstantTimeCompare([]byte(code1), []byte(cur)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(code2), []byte(next)) == 1 {
+			h.Counter = c + 2
+			return nil
+		}
+	}
+	return &Error{ECResyncFailed, "couldn't resynchronise the counter", nil}
+}
@@ -33,7 +33,7 @@ func TestHotp(t *testing.T) {
 	// check values
 	kh := k.(*Hotp)
 	// same label ?
-	if kh.Label != "mydomain.com" {
+	if kh.AccountName != "mydomain.com" {
 		t.Error("got a different label")
 		return
 	}
@@ -65,7 +65,7 @@ func TestHotp(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	if kh.String() != otpUrl {
+	if kh.Url() != otpUrl {
 		t.Error("got a different url")
 		return
 	}
@@ -94,4 +94,73 @@ func TestHotp(t *testing.T) {
 		t.Error("got the wrong code")
 		return
 	}
+	if kh.CodeString() != "100502" || kh.CodeNString(1) != "801920" {
+		t.Error("got the wrong code string")
+		return
+	}
+	// RFC 4226 appendix D, zero padded
+	kh = &Hotp{Common: &Common{Key: []byte("12345678901234567890"), AccountName: "rfc4226", Digits: 9}}
+	if c := kh.CodeCounterString(7); c != "082162583" {
+		t.Error("got the wrong code string:", c)
+		return
+	}
+	kh.Digits = 6
+	if c := kh.CodeCounterString(7); c != "162583" {
+		t.Error("got the wrong code string:", c)
+		return
+	}
+}
+
+func TestHotpAccept(t *testing.T) {
+	kh, err := ImportHotp("otpauth://hotp/myKey?counter=0&secret=5STMOV5AVXA2IYVU")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// exact match advances the counter by one
+	if _, err = kh.Accept("100502", 3); err != nil {
+		t.Error(err)
+		return
+	} else if kh.Counter != 1 {
+		t.Error("counter should be 1, got:", kh.Counter)
+		return
+	}
+	// the same code can't be used twice
+	if _, err = kh.Accept("100502", 3); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+	// match in the look-ahead window
+	if ofs, err := kh.Accept("815149", 3); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != 2 || kh.Counter != 4 {
+		t.Error("wrong offset or counter:", ofs, kh.Counter)
+		return
+	}
+	// out of the window
+	kh.Counter = 0
+	if _, err = kh.Accept("783409", 3); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	} else if kh.Counter != 0 {
+		t.Error("counter shouldn't change")
+		return
+	}
+	// resync
+	if err = kh.Resync("222375", "783409", 2); !checkError(err, ECResyncFailed) {
+		t.Error("got the wrong error")
+		return
+	}
+	if err = kh.Resync("222375", "311346", 10); !checkError(err, ECResyncFailed) {
+		t.Error("got the wrong error")
+		return
+	}
+	if err = kh.Resync("222375", "783409", 10); err != nil {
+		t.Error(err)
+		return
+	} else if kh.Counter != 6 {
+		t.Error("counter should be 6, got:", kh.Counter)
+		return
+	}
 }
@@ -0,0 +1,163 @@
+package otp
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limiter defaults.
+const (
+	// Failed attempts before the key is locked out.
+	DefaultMaxFailures = 5
+	// Lockout after DefaultMaxFailures failed attempts.
+	DefaultLockout = 30 * time.Second
+	// Longest lockout.
+	DefaultMaxLockout = time.Hour
+)
+
+// LockoutError is returned by Limiter when a key is locked out.
+// It wraps an *Error with the code ECLocked, so errors.Is(err, ErrLocked) matches it.
+type LockoutError struct {
+	// RetryAfter is the time left until the key is unlocked. 0, locked until Reset.
+	RetryAfter time.Duration
+	// Until is the time the key is unlocked. Zero, locked until Reset.
+	Until time.Time
+
+	err *Error
+}
+
+// new lockout error at now, wrapping the error of the failed attempt, if any
+func newLockoutError(until, now time.Time, err error) *LockoutError {
+	if until.IsZero() {
+		return &LockoutError{err: &Error{ECLocked, "too many failed attempts, locked until reset", err}}
+	}
+	retry := until.Sub(now)
+	return &LockoutError{retry, until, &Error{ECLocked, fmt.Sprintf("too many failed attempts, retry after %v", retry), err}}
+}
+
+// Implement error.
+func (e *LockoutError) Error() string { return e.err.Error() }
+
+// Unwrap returns the *Error with the code ECLocked.
+func (e *LockoutError) Unwrap() error { return e.err }
+
+// Limiter wraps a Verifier and counts the failed attempts of each key in its Store.
+// After MaxFailures consecutive failures the key is locked out for Lockout, doubled on
+// every further failure up to MaxLockout, and after HardLimit failures it's locked until Reset.
+// While locked out, codes aren't checked and Verify returns a *LockoutError.
+// A successful verification resets the count.
+type Limiter struct {
+	// Verifier that checks the codes, its Store also keeps the failures.
+	Verifier *Verifier
+	// Failed attempts before the key is locked out. <= 0, defaults to DefaultMaxFailures.
+	MaxFailures int
+	// First lockout. <= 0, defaults to DefaultLockout.
+	Lockout time.Duration
+	// Longest lockout. <= 0, defaults to DefaultMaxLockout.
+	MaxLockout time.Duration
+	// Failed attempts that lock the key until Reset. <= 0, no hard lockout.
+	HardLimit int
+	// Clock for the lockouts. nil, defaults to SystemClock.
+	Clock Clock
+}
+
+// NewLimiter creates a *Limiter with the defaults.
+func NewLimiter(v *Verifier) *Limiter { return &Limiter{Verifier: v} }
+
+// Verify checks code for the key k, stored under id, like Verifier.Verify, unless the key is
+// locked out. Every attempt is counted before the code is checked, so concurrent attempts can't
+// exceed the limits; any error, not only a wrong code, counts as a failure. If the attempt
+// locks the key out, the *LockoutError wraps the verification error.
+func (l *Limiter) Verify(id string, k Key, code string) (int, error) {
+	now := clockOrSystem(l.Clock).Now()
+	st, err := l.attempt(id, k, now)
+	if err != nil {
+		return 0, err
+	}
+	ofs, err := l.Verifier.Verify(id, k, code)
+	if err != nil {
+		if st.Failures >= l.maxFailures() || l.HardLimit > 0 && st.Failures >= l.HardLimit {
+			return 0, newLockoutError(st.LockedUntil, now, err)
+		}
+		return 0, err
+	}
+	if err = l.Reset(id); err != nil {
+		return 0, err
+	}
+	return ofs, nil
+}
+
+// Reset clears the failed attempts of id, and unlocks it.
+func (l *Limiter) Reset(id string) error {
+	for {
+		st, ver, err := LoadState(l.Verifier.Store, id)
+		if err != nil || st == nil || st.Failures == 0 && st.LockedUntil.IsZero() {
+			return err
+		}
+		st.Failures, st.LockedUntil = 0, time.Time{}
+		// try again if someone else changed the state
+		if ok, err := SwapState(l.Verifier.Store, id, ver, st); err != nil || ok {
+			return err
+		}
+	}
+}
+
+// check that id isn't locked out and count the attempt as a failure, returns the new state
+func (l *Limiter) attempt(id string, k Key, now time.Time) (*State, error) {
+	for {
+		st, ver, err := LoadState(l.Verifier.Store, id)
+		if err != nil {
+			return nil, err
+		}
+		if st == nil {
+			// the state the verifier would start from
+			st = &State{}
+			if h, ok := k.(*Hotp); ok {
+				st.Counter = h.Counter
+			}
+		}
+		if l.HardLimit > 0 && st.Failures >= l.HardLimit {
+			return nil, newLockoutError(time.Time{}, now, nil)
+		} else if now.Before(st.LockedUntil) {
+			return nil, newLockoutError(st.LockedUntil, now, nil)
+		}
+		st.Failures++
+		if l.HardLimit > 0 && st.Failures >= l.HardLimit {
+			st.LockedUntil = time.Time{}
+		} else if st.Failures >= l.maxFailures() {
+			st.LockedUntil = now.Add(l.lockout(st.Failures - l.maxFailures()))
+		}
+		// try again if someone else changed the state
+		if ok, err := SwapState(l.Verifier.Store, id, ver, st); err != nil {
+			return nil, err
+		} else if ok {
+			return st, nil
+		}
+	}
+}
+
+// failures before the lockout
+func (l *Limiter) maxFailures() int {
+	if l.MaxFailures <= 0 {
+		return DefaultMaxFailures
+	}
+	return l.MaxFailures
+}
+
+// lockout after n failures past MaxFailures: Lockout doubled n times, up to MaxLockout
+func (l *Limiter) lockout(n int) time.Duration {
+	d, max := l.Lockout, l.MaxLockout
+	if d <= 0 {
+		d = DefaultLockout
+	}
+	if max <= 0 {
+		max = DefaultMaxLockout
+	}
+	for ; n > 0 && d < max; n-- {
+		d *= 2
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
@@ -0,0 +1,119 @@
+package otp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	s := NewMemoryStore()
+	clk := NewFakeClock(time.Unix(0, 0).Add(DefaultPeriod * 2))
+	l := &Limiter{Verifier: &Verifier{Store: s, Clock: clk}, MaxFailures: 3, Lockout: time.Minute, MaxLockout: 3 * time.Minute, Clock: clk}
+	kt, err := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = l.Verify("alice", kt, "000000"); !checkError(err, ECInvalidCode) {
+			t.Error("expected ECInvalidCode, got", err)
+			return
+		}
+	}
+	// the third failure locks the key out
+	_, err = l.Verify("alice", kt, "000000")
+	var le *LockoutError
+	if !errors.As(err, &le) || le.RetryAfter != time.Minute || !errors.Is(err, ErrLocked) || !errors.Is(err, ErrInvalidCode) {
+		t.Error("expected a lockout for 1m, got", err)
+		return
+	}
+	// a valid code isn't checked while locked out
+	clk.Advance(30 * time.Second)
+	if _, err = l.Verify("alice", kt, kt.CodePeriodString(kt.step(clk.Now()))); !errors.As(err, &le) || le.RetryAfter != 30*time.Second {
+		t.Error("expected a lockout for 30s, got", err)
+		return
+	}
+	if errors.Is(err, ErrInvalidCode) {
+		t.Error("the code shouldn't be checked:", err)
+		return
+	}
+	// every further failure doubles the lockout, up to MaxLockout
+	for _, d := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		clk.Set(le.Until)
+		if _, err = l.Verify("alice", kt, "000000"); !errors.As(err, &le) || le.RetryAfter != d {
+			t.Error("expected a lockout for", d, "got", err)
+			return
+		}
+	}
+	if st, _, err := LoadState(s, "alice"); err != nil || st.Failures != 6 || !st.LockedUntil.Equal(le.Until) {
+		t.Error("wrong state:", st, err)
+		return
+	}
+	// success resets the failures
+	clk.Set(le.Until)
+	if _, err = l.Verify("alice", kt, kt.CodePeriodString(kt.step(clk.Now()))); err != nil {
+		t.Error(err)
+		return
+	}
+	if st, _, err := LoadState(s, "alice"); err != nil || st.Failures != 0 || !st.LockedUntil.IsZero() || st.LastStep != kt.step(clk.Now()) {
+		t.Error("wrong state:", st, err)
+		return
+	}
+	// replays count as failures
+	if _, err = l.Verify("alice", kt, kt.CodePeriodString(kt.step(clk.Now()))); !checkError(err, ECReplayed) {
+		t.Error("expected ECReplayed, got", err)
+		return
+	}
+	if st, _, err := LoadState(s, "alice"); err != nil || st.Failures != 1 {
+		t.Error("wrong state:", st, err)
+		return
+	}
+}
+
+func TestLimiterHardLimit(t *testing.T) {
+	s := NewMemoryStore()
+	clk := NewFakeClock(time.Unix(0, 0))
+	l := &Limiter{Verifier: NewVerifier(s, &VerifyOpts{Ahead: 3}), MaxFailures: 2, HardLimit: 3, Clock: clk}
+	kh, err := ImportHotp("otpauth://hotp/myKey?counter=0&secret=5STMOV5AVXA2IYVU")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = l.Verify("bob", kh, "000000"); !checkError(err, ECInvalidCode) {
+		t.Error("expected ECInvalidCode, got", err)
+		return
+	}
+	// the counter of the key is kept on the first attempt
+	if _, err = l.Verify("bob", kh, "801920"); err != nil {
+		t.Error(err)
+		return
+	}
+	var le *LockoutError
+	if _, err = l.Verify("bob", kh, "000000"); !checkError(err, ECInvalidCode) {
+		t.Error("expected ECInvalidCode, got", err)
+		return
+	}
+	if _, err = l.Verify("bob", kh, "000000"); !errors.As(err, &le) || le.RetryAfter != DefaultLockout {
+		t.Error("expected a lockout for", DefaultLockout, "got", err)
+		return
+	}
+	clk.Advance(time.Hour)
+	if _, err = l.Verify("bob", kh, "000000"); !errors.As(err, &le) || le.RetryAfter != 0 || !le.Until.IsZero() {
+		t.Error("expected a hard lockout, got", err)
+		return
+	}
+	clk.Advance(24 * time.Hour)
+	if _, err = l.Verify("bob", kh, "311346"); !errors.Is(err, ErrLocked) {
+		t.Error("expected ECLocked, got", err)
+		return
+	}
+	if err = l.Reset("bob"); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = l.Verify("bob", kh, "311346"); err != nil {
+		t.Error(err)
+		return
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package otp
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// try to create the file at path, it's removed on unlock. There are no advisory
+// locks here, so a lock file older than stale is left by a dead process and broken.
+// ok is false if another process holds it.
+func lockFile(path string, stale time.Duration) (unlock func(), ok bool, err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		if fi, serr := os.Stat(path); serr == nil && time.Since(fi.ModTime()) > stale {
+			os.Remove(path)
+		}
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	// the owner, for whoever finds it left behind
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+	return func() { os.Remove(path) }, true, nil
+}
@@ -0,0 +1,382 @@
+package otp
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keyData is the structured form of a key, used by the JSON and binary encodings.
+type keyData struct {
+	Type      string     `json:"type"`
+	Secret    string     `json:"secret"`
+	Issuer    string     `json:"issuer,omitempty"`
+	Account   string     `json:"account"`
+	Algorithm string     `json:"algorithm,omitempty"`
+	Digits    int        `json:"digits,omitempty"`
+	Counter   int        `json:"counter,omitempty"`
+	Period    float64    `json:"period,omitempty"` // seconds
+	T0        int64      `json:"t0,omitempty"`     // Unix time
+	LastStep  int        `json:"last_step,omitempty"`
+	Used      bool       `json:"used,omitempty"`
+	Drift     int        `json:"drift,omitempty"`
+	Params    url.Values `json:"params,omitempty"`
+
+	// exact period, for the binary encoding. 0, use Period.
+	period time.Duration
+}
+
+// structured form of the common fields
+func (k *Common) keyData(typ string) *keyData {
+	issuer, account := k.names()
+	return &keyData{
+		Type:      typ,
+		Secret:    k.Key32(),
+		Issuer:    issuer,
+		Account:   account,
+		Algorithm: k.Algorithm,
+		Digits:    k.Digits,
+		Params:    k.Params,
+	}
+}
+
+// structured form of a totp key
+func (t *Totp) keyData() *keyData {
+	d := t.Common.keyData(TypeTotp)
+	if t.Period > 0 {
+		d.Period, d.period = t.Period.Seconds(), t.Period
+	}
+	if !t.T0.IsZero() {
+		d.T0 = t.T0.Unix()
+	}
+	d.LastStep, d.Used, d.Drift = t.LastStep, t.Used, t.Drift
+	return d
+}
+
+// structured form of a hotp key
+func (h *Hotp) keyData() *keyData {
+	d := h.Common.keyData(TypeHotp)
+	d.Counter = h.Counter
+	return d
+}
+
+// key from the structured form, validated by importing the equivalent otpauth url
+func (d *keyData) key() (Key, error) {
+	q := url.Values{}
+	for name, vals := range d.Params {
+		switch strings.ToLower(name) {
+		case "secret", "digits", "algorithm", "issuer", "counter", "period", "t0":
+			continue
+		}
+		q[name] = vals
+	}
+	q.Set("secret", d.Secret)
+	if d.Issuer != "" {
+		q.Set("issuer", d.Issuer)
+	}
+	if d.Algorithm != "" {
+		q.Set("algorithm", d.Algorithm)
+	}
+	if d.Digits != 0 {
+		q.Set("digits", strconv.Itoa(d.Digits))
+	}
+	switch d.Type {
+	case TypeHotp:
+		q.Set("counter", strconv.Itoa(d.Counter))
+	case TypeTotp:
+		if d.Period != 0 {
+			q.Set("period", strconv.FormatFloat(d.Period, 'f', -1, 64))
+		}
+		if d.T0 != 0 {
+			q.Set("t0", strconv.FormatInt(d.T0, 10))
+		}
+	}
+	label := d.Account
+	if d.Issuer != "" {
+		label = d.Issuer + ":" + d.Account
+	}
+	u := &url.URL{Scheme: "otpauth", Host: d.Type, Path: "/" + label, RawQuery: q.Encode()}
+	k, err := ImportKey(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := k.(*Totp); ok {
+		if d.period > 0 {
+			t.Period = d.period
+		}
+		t.LastStep, t.Used, t.Drift = d.LastStep, d.Used, d.Drift
+	}
+	return k, nil
+}
+
+// version of the binary encoding
+const binaryVersion = 1
+
+// binary encoding, a version byte followed by protobuf fields
+func (d *keyData) marshalBinary() []byte {
+	b := []byte{binaryVersion}
+	typ := uint64(2)
+	if d.Type == TypeHotp {
+		typ = 1
+	}
+	b = pbAppendVarint(b, 1, typ)
+	key, _ := decodeKey32(d.Secret, false)
+	b = pbAppendBytes(b, 2, key)
+	b = pbAppendBytes(b, 3, []byte(d.Account))
+	for _, f := range []struct {
+		field int
+		s     string
+	}{{4, d.Issuer}, {5, d.Algorithm}, {10, d.Params.Encode()}} {
+		if f.s != "" {
+			b = pbAppendBytes(b, f.field, []byte(f.s))
+		}
+	}
+	period := d.period
+	if period == 0 {
+		period = time.Duration(math.Round(d.Period * float64(time.Second)))
+	}
+	for _, f := range []struct {
+		field int
+		v     int64
+	}{
+		{6, int64(d.Digits)}, {7, int64(d.Counter)}, {8, int64(period)},
+		{9, d.T0}, {11, int64(d.LastStep)}, {12, int64(d.Drift)},
+	} {
+		if f.v != 0 {
+			b = pbAppendVarint(b, f.field, uint64(f.v))
+		}
+	}
+	if d.Used {
+		b = pbAppendVarint(b, 13, 1)
+	}
+	return b
+}
+
+// decode the binary encoding
+func unmarshalBinary(b []byte) (*keyData, error) {
+	if len(b) == 0 || b[0] != binaryVersion {
+		return nil, &Error{ECInvalidEncoding, "unsupported binary key version", nil}
+	}
+	d := &keyData{Type: TypeTotp}
+	err := pbDecode(b[1:], ECInvalidEncoding, func(field int, v uint64, data []byte) error {
+		var err error
+		switch field {
+		case 1:
+			if v == 1 {
+				d.Type = TypeHotp
+			}
+		case 2:
+			d.Secret = (&Common{Key: data}).Key32()
+		case 3:
+			d.Account = string(data)
+		case 4:
+			d.Issuer = string(data)
+		case 5:
+			d.Algorithm = string(data)
+		case 6:
+			d.Digits = int(int64(v))
+		case 7:
+			d.Counter = int(int64(v))
+		case 8:
+			d.period = time.Duration(v)
+			d.Period = d.period.Seconds()
+		case 9:
+			d.T0 = int64(v)
+		case 10:
+			if d.Params, err = url.ParseQuery(string(data)); err != nil {
+				return &Error{ECInvalidEncoding, "invalid binary key parameters", err}
+			}
+		case 11:
+			d.LastStep = int(int64(v))
+		case 12:
+			d.Drift = int(int64(v))
+		case 13:
+			d.Used = v != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// decode the JSON encoding
+func unmarshalJSON(b []byte) (*keyData, error) {
+	d := &keyData{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, &Error{ECInvalidEncoding, "invalid JSON key", err}
+	}
+	return d, nil
+}
+
+// UnmarshalKeyJSON decodes a JSON encoded key of either type.
+func UnmarshalKeyJSON(b []byte) (Key, error) {
+	d, err := unmarshalJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	return d.key()
+}
+
+// UnmarshalKeyBinary decodes a binary encoded key of either type.
+func UnmarshalKeyBinary(b []byte) (Key, error) {
+	d, err := unmarshalBinary(b)
+	if err != nil {
+		return nil, err
+	}
+	return d.key()
+}
+
+// totp key from the structured form
+func (d *keyData) totp() (*Totp, error) {
+	k, err := d.key()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := k.(*Totp)
+	if !ok {
+		return nil, &Error{ECNotTotp, fmt.Sprintf("not a totp key: %v", d.Type), nil}
+	}
+	return t, nil
+}
+
+// hotp key from the structured form
+func (d *keyData) hotp() (*Hotp, error) {
+	k, err := d.key()
+	if err != nil {
+		return nil, err
+	}
+	h, ok := k.(*Hotp)
+	if !ok {
+		return nil, &Error{ECNotHotp, fmt.Sprintf("not a hotp key: %v", d.Type), nil}
+	}
+	return h, nil
+}
+
+// replace the key with k, keeping the clock
+func (t *Totp) set(k *Totp) {
+	k.Clock = t.Clock
+	*t = *k
+}
+
+// MarshalText returns the otpauth url.
+func (t Totp) MarshalText() ([]byte, error) { return []byte(t.Url()), nil }
+
+// UnmarshalText imports an otpauth url.
+func (t *Totp) UnmarshalText(b []byte) error {
+	k, err := ImportTotp(string(b))
+	if err != nil {
+		return err
+	}
+	t.set(k)
+	return nil
+}
+
+// MarshalJSON encodes the key as a JSON object.
+func (t Totp) MarshalJSON() ([]byte, error) { return json.Marshal(t.keyData()) }
+
+// UnmarshalJSON decodes a JSON object, which must be a totp key.
+func (t *Totp) UnmarshalJSON(b []byte) error {
+	d, err := unmarshalJSON(b)
+	if err != nil {
+		return err
+	}
+	k, err := d.totp()
+	if err != nil {
+		return err
+	}
+	t.set(k)
+	return nil
+}
+
+// MarshalBinary encodes the key in a compact binary format.
+func (t Totp) MarshalBinary() ([]byte, error) { return t.keyData().marshalBinary(), nil }
+
+// UnmarshalBinary decodes the binary format, which must be a totp key.
+func (t *Totp) UnmarshalBinary(b []byte) error {
+	d, err := unmarshalBinary(b)
+	if err != nil {
+		return err
+	}
+	k, err := d.totp()
+	if err != nil {
+		return err
+	}
+	t.set(k)
+	return nil
+}
+
+// MarshalText returns the otpauth url.
+func (h Hotp) MarshalText() ([]byte, error) { return []byte(h.Url()), nil }
+
+// UnmarshalText imports an otpauth url.
+func (h *Hotp) UnmarshalText(b []byte) error {
+	k, err := ImportHotp(string(b))
+	if err != nil {
+		return err
+	}
+	*h = *k
+	return nil
+}
+
+// MarshalJSON encodes the key as a JSON object.
+func (h Hotp) MarshalJSON() ([]byte, error) { return json.Marshal(h.keyData()) }
+
+// UnmarshalJSON decodes a JSON object, which must be a hotp key.
+func (h *Hotp) UnmarshalJSON(b []byte) error {
+	d, err := unmarshalJSON(b)
+	if err != nil {
+		return err
+	}
+	k, err := d.hotp()
+	if err != nil {
+		return err
+	}
+	*h = *k
+	return nil
+}
+
+// MarshalBinary encodes the key in a compact binary format.
+func (h Hotp) MarshalBinary() ([]byte, error) { return h.keyData().marshalBinary(), nil }
+
+// UnmarshalBinary decodes the binary format, which must be a hotp key.
+func (h *Hotp) UnmarshalBinary(b []byte) error {
+	d, err := unmarshalBinary(b)
+	if err != nil {
+		return err
+	}
+	k, err := d.hotp()
+	if err != nil {
+		return err
+	}
+	*h = *k
+	return nil
+}
+
+// ensure that we implement the encoding interfaces, marshalling values too
+var (
+	_ encoding.TextMarshaler     = Totp{}
+	_ json.Marshaler             = Totp{}
+	_ encoding.BinaryMarshaler   = Totp{}
+	_ encoding.TextMarshaler     = Hotp{}
+	_ json.Marshaler             = Hotp{}
+	_ encoding.BinaryMarshaler   = Hotp{}
+	_ encoding.TextMarshaler     = (*Totp)(nil)
+	_ encoding.TextUnmarshaler   = (*Totp)(nil)
+	_ json.Marshaler             = (*Totp)(nil)
+	_ json.Unmarshaler           = (*Totp)(nil)
+	_ encoding.BinaryMarshaler   = (*Totp)(nil)
+	_ encoding.BinaryUnmarshaler = (*Totp)(nil)
+	_ encoding.TextMarshaler     = (*Hotp)(nil)
+	_ encoding.TextUnmarshaler   = (*Hotp)(nil)
+	_ json.Marshaler             = (*Hotp)(nil)
+	_ json.Unmarshaler           = (*Hotp)(nil)
+	_ encoding.BinaryMarshaler   = (*Hotp)(nil)
+	_ encoding.BinaryUnmarshaler = (*Hotp)(nil)
+)
@@ -0,0 +1,221 @@
+package otp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMarshalText(t *testing.T) {
+	kt, err := ImportTotp("otpauth://totp/Example:alice?secret=ADS2OR6Q6K3OJZDW&issuer=Example&period=60&image=x")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b, err := kt.MarshalText()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(b) != kt.Url() {
+		t.Error("wrong text:", string(b))
+		return
+	}
+	kt2 := &Totp{}
+	if err = kt2.UnmarshalText(b); err != nil {
+		t.Error(err)
+		return
+	} else if kt2.Url() != kt.Url() {
+		t.Error("wrong key:", kt2.Url())
+		return
+	}
+	kh := &Hotp{}
+	if err = kh.UnmarshalText(b); !errors.Is(err, ErrNotHotp) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	if err = kh.UnmarshalText([]byte("otpauth://hotp/alice?secret=ADS2OR6Q6K3OJZDW&counter=5")); err != nil || kh.Counter != 5 {
+		t.Error("wrong key:", err, kh.Counter)
+		return
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	kt, err := ImportTotp("otpauth://totp/Example:alice?secret=ADS2OR6Q6K3OJZDW&issuer=Example&period=60&t0=100&digits=8&algorithm=sha256&image=x")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kt.LastStep, kt.Used, kt.Drift = 1000, true, -1
+	b, err := json.Marshal(kt)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const want = `{"type":"totp","secret":"ADS2OR6Q6K3OJZDW","issuer":"Example","account":"alice","algorithm":"sha256","digits":8,"period":60,"t0":100,"last_step":1000,"used":true,"drift":-1,"params":{"image":["x"]}}`
+	if string(b) != want {
+		t.Error("wrong JSON:", string(b))
+		return
+	}
+	kt2 := &Totp{Clock: NewFakeClock(time.Unix(0, 0))}
+	if err = json.Unmarshal(b, kt2); err != nil {
+		t.Error(err)
+		return
+	}
+	if kt2.Url() != kt.Url() || kt2.LastStep != 1000 || !kt2.Used || kt2.Drift != -1 || kt2.Clock == nil {
+		t.Error("wrong key:", kt2.Url(), kt2.LastStep, kt2.Drift)
+		return
+	}
+	// hotp in a struct, and any type
+	kh, err := ImportHotp("otpauth://hotp/alice?secret=ADS2OR6Q6K3OJZDW&counter=7")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var s struct{ Key *Hotp }
+	if b, err = json.Marshal(struct{ Key *Hotp }{kh}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = json.Unmarshal(b, &s); err != nil {
+		t.Error(err)
+		return
+	} else if s.Key.Url() != kh.Url() {
+		t.Error("wrong key:", s.Key.Url())
+		return
+	}
+	// keys held by value use the same encoding, never the raw fields
+	if b, err = json.Marshal(struct {
+		T Totp
+		H Hotp
+	}{*kt, *kh}); err != nil {
+		t.Error(err)
+		return
+	}
+	var sv struct {
+		T Totp
+		H Hotp
+	}
+	if err = json.Unmarshal(b, &sv); err != nil {
+		t.Error(err)
+		return
+	} else if sv.T.Url() != kt.Url() || sv.H.Url() != kh.Url() || bytes.Contains(b, []byte(`"Key"`)) {
+		t.Error("wrong JSON:", string(b))
+		return
+	}
+	if tb, err := kt.MarshalText(); err != nil {
+		t.Error(err)
+		return
+	} else if vb, _ := (*kt).MarshalText(); string(vb) != string(tb) {
+		t.Error("wrong text:", string(vb))
+		return
+	}
+	k, err := UnmarshalKeyJSON([]byte(`{"type":"hotp","secret":"ads2 or6q 6k3o jzdw","account":"bob","counter":3}`))
+	if err != nil {
+		t.Error(err)
+		return
+	} else if k.Url() != "otpauth://hotp/bob?counter=3&secret=ADS2OR6Q6K3OJZDW" {
+		t.Error("wrong key:", k.Url())
+		return
+	}
+	// same validation as ImportKey
+	for _, v := range []struct {
+		j  string
+		ec ErrorCode
+	}{
+		{`{"type":"totp","secret":"ADS2OR6Q6K3OJZDW"}`, ECMissingLabel},
+		{`{"type":"totp","account":"alice"}`, ECMissingSecret},
+		{`{"type":"totp","secret":"A!S2OR6Q6K3OJZDW","account":"alice"}`, ECBase32Decoding},
+		{`{"type":"totp","secret":"ADS2OR6Q6K3OJZDW","account":"alice","algorithm":"md5"}`, ECInvalidAlgorithm},
+		{`{"type":"totp","secret":"ADS2OR6Q6K3OJZDW","account":"alice","period":-1}`, ECInvalidPeriod},
+		{`{"type":"xotp","secret":"ADS2OR6Q6K3OJZDW","account":"alice"}`, ECInvalidOtpType},
+		{`{"type":"hotp","secret":"ADS2OR6Q6K3OJZDW","account":"alice"}`, ECNotTotp},
+	} {
+		if err = json.Unmarshal([]byte(v.j), &Totp{}); !checkError(err, v.ec) {
+			t.Errorf("got the wrong error for %s: %v", v.j, err)
+			return
+		}
+	}
+	if _, err = UnmarshalKeyJSON([]byte(`{"type":"totp"`)); !checkError(err, ECInvalidEncoding) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	kt, err := ImportTotp("otpauth://totp/Example:alice?secret=ADS2OR6Q6K3OJZDW&issuer=Example&period=0.5&t0=-100&image=x")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kt.LastStep, kt.Used, kt.Drift = -1000, true, -2
+	b, err := kt.MarshalBinary()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// smaller than the url
+	if len(b) >= len(kt.Url()) {
+		t.Error("binary encoding is too long:", len(b))
+		return
+	}
+	kt2 := &Totp{}
+	if err = kt2.UnmarshalBinary(b); err != nil {
+		t.Error(err)
+		return
+	}
+	if kt2.Url() != kt.Url() || kt2.Period != 500*time.Millisecond || kt2.LastStep != -1000 || !kt2.Used || kt2.Drift != -2 {
+		t.Error("wrong key:", kt2.Url(), kt2.Period, kt2.LastStep, kt2.Drift)
+		return
+	}
+	if err = (&Hotp{}).UnmarshalBinary(b); !checkError(err, ECNotHotp) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	// periods survive the round trip to the nanosecond, 1.003s used to lose 1ns
+	for ms := 1; ms <= 100000; ms++ {
+		kp := &Totp{Common: kt.Common, Period: time.Duration(ms) * time.Millisecond}
+		b, err := kp.MarshalBinary()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		kp2 := &Totp{}
+		if err = kp2.UnmarshalBinary(b); err != nil {
+			t.Error(err)
+			return
+		} else if kp2.Period != kp.Period {
+			t.Error("wrong period:", kp2.Period, "expected:", kp.Period)
+			return
+		}
+	}
+	kh, err := ImportHotp("otpauth://hotp/alice?secret=ADS2OR6Q6K3OJZDW&counter=12345&digits=8")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if b, err = kh.MarshalBinary(); err != nil {
+		t.Error(err)
+		return
+	}
+	if k, err := UnmarshalKeyBinary(b); err != nil {
+		t.Error(err)
+		return
+	} else if k.Url() != kh.Url() {
+		t.Error("wrong key:", k.Url())
+		return
+	}
+	for _, bb := range [][]byte{nil, {2}, append(b[:len(b)-1:len(b)-1], 0xff)} {
+		if _, err = UnmarshalKeyBinary(bb); !checkError(err, ECInvalidEncoding) {
+			t.Error("got the wrong error:", err)
+			return
+		}
+	}
+	// the secret is validated
+	if _, err = UnmarshalKeyBinary([]byte{binaryVersion, 3<<3 | 2, 1, 'a'}); !checkError(err, ECMissingSecret) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+}
@@ -0,0 +1,331 @@
+package otp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Google Authenticator migration urls: otpauth-migration://offline?data=...
+// data is a base64 encoded protobuf message:
+//
+//	message MigrationPayload {
+//	  message OtpParameters {
+//	    bytes secret = 1;
+//	    string name = 2;
+//	    string issuer = 3;
+//	    Algorithm algorithm = 4; // 1: sha1, 2: sha256, 3: sha512, 4: md5
+//	    DigitCount digits = 5;   // 1: 6, 2: 8
+//	    OtpType type = 6;        // 1: hotp, 2: totp
+//	    int64 counter = 7;
+//	  }
+//	  repeated OtpParameters otp_parameters = 1;
+//	  int32 version = 2;
+//	  int32 batch_size = 3;
+//	  int32 batch_index = 4;
+//	  int32 batch_id = 5;
+//	}
+const (
+	migrationScheme = "otpauth-migration"
+	migrationHost   = "offline"
+)
+
+// MigrationBatch holds the batch metadata of a migration url.
+// Exports with many keys are split in several urls, sharing the same ID.
+type MigrationBatch struct {
+	// Payload version.
+	Version int
+	// Number of urls in the batch.
+	Size int
+	// Index of the url in the batch.
+	Index int
+	// Batch ID.
+	ID int
+}
+
+// ImportMigration imports the keys in a Google Authenticator
+// migration url (otpauth-migration://offline?data=...).
+func ImportMigration(u string) ([]Key, *MigrationBatch, error) {
+	mu, err := url.Parse(u)
+	if err != nil {
+		return nil, nil, urlParseError(err)
+	} else if mu.Scheme != migrationScheme {
+		return nil, nil, &Error{ECWrongScheme, fmt.Sprintf("bad scheme: %s", mu.Scheme), nil}
+	} else if mu.Host != migrationHost {
+		return nil, nil, &Error{ECInvalidMigration, fmt.Sprintf("bad migration host: %s", mu.Host), nil}
+	}
+	// a '+' that wasn't escaped is decoded as a space
+	d := strings.Replace(mu.Query().Get("data"), " ", "+", -1)
+	b, err := base64.StdEncoding.DecodeString(d)
+	if err != nil {
+		if b, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(d, "=")); err != nil {
+			return nil, nil, &Error{ECInvalidMigration, fmt.Sprintf("can't decode migration data: %v", err), err}
+		}
+	}
+	return decodeMigration(b)
+}
+
+// ExportMigration exports keys as Google Authenticator migration urls,
+// with up to batchSize keys in each url. batchSize <= 0, exports all keys in one url.
+// Only 6 and 8 digit keys and TOTP keys with the default period and T0 can be exported.
+func ExportMigration(keys []Key, batchSize int) ([]string, error) {
+	if batchSize <= 0 || batchSize > len(keys) {
+		batchSize = len(keys)
+	}
+	// encode the keys
+	params := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		p, err := encodeMigrationKey(k)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, p)
+	}
+	// random batch id
+	var rb [4]byte
+	if _, err := rand.Read(rb[:]); err != nil {
+		return nil, &Error{ECCantReadRandom, "error reading random bytes", err}
+	}
+	id := uint64(binary.BigEndian.Uint32(rb[:]) & 0x7fffffff)
+	n := 1
+	if batchSize > 0 {
+		n = (len(params) + batchSize - 1) / batchSize
+	}
+	r := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		var b []byte
+		for j := i * batchSize; j < (i+1)*batchSize && j < len(params); j++ {
+			b = pbAppendBytes(b, 1, params[j])
+		}
+		b = pbAppendVarint(b, 2, 1)
+		b = pbAppendVarint(b, 3, uint64(n))
+		b = pbAppendVarint(b, 4, uint64(i))
+		b = pbAppendVarint(b, 5, id)
+		u := &url.URL{
+			Scheme:   migrationScheme,
+			Host:     migrationHost,
+			RawQuery: url.Values{"data": []string{base64.StdEncoding.EncodeToString(b)}}.Encode(),
+		}
+		r = append(r, u.String())
+	}
+	return r, nil
+}
+
+// decode a MigrationPayload message
+func decodeMigration(b []byte) ([]Key, *MigrationBatch, error) {
+	var (
+		keys  []Key
+		batch = &MigrationBatch{}
+	)
+	err := pbDecode(b, ECInvalidMigration, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			k, err := decodeMigrationKey(data)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, k)
+		case 2:
+			batch.Version = int(v)
+		case 3:
+			batch.Size = int(v)
+		case 4:
+			batch.Index = int(v)
+		case 5:
+			batch.ID = int(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, batch, nil
+}
+
+// decode an OtpParameters message
+func decodeMigrationKey(b []byte) (Key, error) {
+	var (
+		k       = &Common{Digits: DefaultDigits}
+		typ     = TypeTotp
+		counter int
+		name    string
+	)
+	err := pbDecode(b, ECInvalidMigration, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			k.Key = append([]byte(nil), data...)
+		case 2:
+			name = string(data)
+		case 3:
+			k.Issuer = string(data)
+		case 4:
+			switch v {
+			case 0, 1:
+				k.Algorithm = ""
+			case 2:
+				k.Algorithm = "sha256"
+			case 3:
+				k.Algorithm = "sha512"
+			default:
+				return &Error{ECInvalidAlgorithm, fmt.Sprintf("unsupported migration algorithm: %d", v), nil}
+			}
+		case 5:
+			switch v {
+			case 0, 1:
+				k.Digits = 6
+			case 2:
+				k.Digits = 8
+			default:
+				return &Error{ECInvalidDigits, fmt.Sprintf("unsupported migration digits: %d", v), nil}
+			}
+		case 6:
+			switch v {
+			case 1:
+				typ = TypeHotp
+			case 0, 2:
+				typ = TypeTotp
+			default:
+				return &Error{ECInvalidOtpType, fmt.Sprintf("unsupported migration OTP type: %d", v), nil}
+			}
+		case 7:
+			counter = int(int64(v))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(k.Key) == 0 {
+		return nil, &Error{ECMissingSecret, "the secret parameter is required", nil}
+	}
+	if k.Issuer, k.AccountName, err = parseLabel(name, k.Issuer); err != nil {
+		return nil, err
+	}
+	k.Label = k.FullLabel()
+	if typ == TypeHotp {
+		return &Hotp{Common: k, Counter: counter}, nil
+	}
+	return &Totp{Common: k, Period: DefaultPeriod}, nil
+}
+
+// encode an OtpParameters message
+func encodeMigrationKey(k Key) ([]byte, error) {
+	var (
+		c   *Common
+		typ uint64
+		ctr int
+	)
+	switch kk := k.(type) {
+	case *Hotp:
+		c, typ, ctr = kk.Common, 1, kk.Counter
+	case *Totp:
+		if kk.period() != DefaultPeriod || !(kk.T0.IsZero() || kk.T0.Unix() == 0) {
+			return nil, &Error{ECInvalidMigration, "only totp keys with the default period and t0 can be migrated", nil}
+		}
+		c, typ = kk.Common, 2
+	default:
+		return nil, &Error{ECInvalidOtpType, fmt.Sprintf("invalid OTP authentication type: %v", k.Type()), nil}
+	}
+	var b []byte
+	b = pbAppendBytes(b, 1, c.Key)
+	b = pbAppendBytes(b, 2, []byte(c.FullLabel()))
+	if c.Issuer != "" {
+		b = pbAppendBytes(b, 3, []byte(c.Issuer))
+	}
+	switch a := strings.ToLower(c.Algorithm); a {
+	case "", "sha1":
+		b = pbAppendVarint(b, 4, 1)
+	case "sha256":
+		b = pbAppendVarint(b, 4, 2)
+	case "sha512":
+		b = pbAppendVarint(b, 4, 3)
+	default:
+		return nil, &Error{ECInvalidAlgorithm, fmt.Sprintf("unknown algorithm: %v", c.Algorithm), nil}
+	}
+	switch c.Digits {
+	case 6:
+		b = pbAppendVarint(b, 5, 1)
+	case 8:
+		b = pbAppendVarint(b, 5, 2)
+	default:
+		return nil, &Error{ECInvalidDigits, fmt.Sprintf("only 6 or 8 digits can be migrated, got: %d", c.Digits), nil}
+	}
+	b = pbAppendVarint(b, 6, typ)
+	if typ == 1 {
+		b = pbAppendVarint(b, 7, uint64(int64(ctr)))
+	}
+	return b, nil
+}
+
+// protobuf wire types
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+// decode a protobuf message, calling fn with the value of varint fields
+// or the data of length delimited fields. Other fields are skipped.
+// Malformed messages return an error with the code ec.
+func pbDecode(b []byte, ec ErrorCode, fn func(field int, v uint64, data []byte) error) error {
+	bad := func() error { return &Error{ec, "invalid protobuf payload", nil} }
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return bad()
+		}
+		b = b[n:]
+		var (
+			v    uint64
+			data []byte
+		)
+		switch tag & 7 {
+		case pbVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return bad()
+			}
+			b = b[n:]
+		case pbFixed64:
+			if len(b) < 8 {
+				return bad()
+			}
+			b = b[8:]
+			continue
+		case pbBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return bad()
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		case pbFixed32:
+			if len(b) < 4 {
+				return bad()
+			}
+			b = b[4:]
+			continue
+		default:
+			return bad()
+		}
+		if err := fn(int(tag>>3), v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// append a varint field
+func pbAppendVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|pbVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// append a length delimited field
+func pbAppendBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|pbBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,116 @@
+package otp
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMigration(t *testing.T) {
+	kh, err := ImportHotp("otpauth://hotp/myKey?algorithm=sha256&counter=42&digits=8&issuer=ACME&secret=5STMOV5AVXA2IYVU")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kt, err := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	keys := []Key{kh, kt, kt}
+	// one batch
+	us, err := ExportMigration(keys, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if len(us) != 1 || !strings.HasPrefix(us[0], "otpauth-migration://offline?data=") {
+		t.Error("got the wrong urls:", us)
+		return
+	}
+	ks, b, err := ImportMigration(us[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(ks) != 3 || b.Size != 1 || b.Index != 0 || b.Version != 1 {
+		t.Error("got the wrong keys or batch:", ks, b)
+		return
+	}
+	for i, k := range ks {
+		if k.Url() != keys[i].Url() {
+			t.Error("got a different key. expected:", keys[i].Url(), "got:", k.Url())
+			return
+		}
+	}
+	// several batches
+	if us, err = ExportMigration(keys, 2); err != nil {
+		t.Error(err)
+		return
+	} else if len(us) != 2 {
+		t.Error("expected 2 urls, got:", len(us))
+		return
+	}
+	var id int
+	for i, u := range us {
+		ks, b, err := ImportMigration(u)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if i == 0 {
+			id = b.ID
+		}
+		if b.Size != 2 || b.Index != i || b.ID != id || len(ks) != 2-i {
+			t.Error("got the wrong batch:", b, len(ks))
+			return
+		}
+	}
+	// keys that can't be migrated
+	kt2 := *kt
+	kt2.Period *= 2
+	if _, err = ExportMigration([]Key{&kt2}, 0); !checkError(err, ECInvalidMigration) {
+		t.Error("got the wrong error")
+		return
+	}
+	kh.Digits = 7
+	if _, err = ExportMigration([]Key{kh}, 0); !checkError(err, ECInvalidDigits) {
+		t.Error("got the wrong error")
+		return
+	}
+	// hand made payload: totp, sha1, 6 digits, "Issuer:alice", issuer "Issuer", secret "Hello!"
+	var p []byte
+	p = pbAppendBytes(p, 1, []byte("Hello!"))
+	p = pbAppendBytes(p, 2, []byte("Issuer:alice"))
+	p = pbAppendBytes(p, 3, []byte("Issuer"))
+	p = pbAppendVarint(p, 4, 1)
+	p = pbAppendVarint(p, 5, 1)
+	p = pbAppendVarint(p, 6, 2)
+	var m []byte
+	m = pbAppendBytes(m, 1, p)
+	m = pbAppendVarint(m, 2, 1)
+	u := "otpauth-migration://offline?data=" + url.QueryEscape(base64.StdEncoding.EncodeToString(m))
+	if ks, _, err = ImportMigration(u); err != nil {
+		t.Error(err)
+		return
+	}
+	if ktt, ok := ks[0].(*Totp); !ok || string(ktt.Key) != "Hello!" || ktt.AccountName != "alice" || ktt.Issuer != "Issuer" || ktt.Digits != 6 {
+		t.Error("got the wrong key:", ks[0])
+		return
+	}
+	// bad urls
+	for _, bu := range []struct {
+		u  string
+		ec ErrorCode
+	}{
+		{"otpauth://offline?data=", ECWrongScheme},
+		{"otpauth-migration://online?data=", ECInvalidMigration},
+		{"otpauth-migration://offline?data=!!!", ECInvalidMigration},
+		{"otpauth-migration://offline?data=" + base64.StdEncoding.EncodeToString([]byte{0x0a, 0x10, 0x01}), ECInvalidMigration},
+	} {
+		if _, _, err = ImportMigration(bu.u); !checkError(err, bu.ec) {
+			t.Error("got the wrong error for", bu.u, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OCRA question formats.
+const (
+	OcraQuestionAlpha   = 'A' // Alphanumeric.
+	OcraQuestionNumeric = 'N' // Numeric.
+	OcraQuestionHex     = 'H' // Hexadecimal.
+)
+
+// size of the question field in the data input
+const ocraQuestionSize = 128
+
+// OcraSuite is a parsed OCRA suite (RFC 6287 section 6).
+type OcraSuite struct {
+	// Algorithm. SHA1, SHA256 or SHA512.
+	Algorithm string
+	// Digits. 4 to 10, or 0 for no truncation: the full HMAC, in hex.
+	Digits int
+	// Whether a counter is part of the input.
+	Counter bool
+	// Question format. One of the OcraQuestion* constants.
+	QuestionFormat byte
+	// Maximum question length, in characters. 4 to 64.
+	QuestionLength int
+	// Hash algorithm for the PIN, empty if the PIN is not part of the input.
+	PinAlgorithm string
+	// Session information length in bytes, 0 if not part of the input.
+	SessionLength int
+	// Time step, 0 if a timestamp is not part of the input.
+	TimeStep time.Duration
+
+	// the suite string
+	suite string
+}
+
+// ParseOcraSuite parses an OCRA suite such as "OCRA-1:HOTP-SHA256-8:QN08-PSHA1".
+func ParseOcraSuite(suite string) (*OcraSuite, error) {
+	bad := func(why string) (*OcraSuite, error) {
+		return nil, &Error{ECInvalidOcraSuite, fmt.Sprintf("invalid OCRA suite %q: %s", suite, why), nil}
+	}
+	parts := strings.Split(suite, ":")
+	if len(parts) != 3 {
+		return bad("expected 3 fields")
+	}
+	if parts[0] != "OCRA-1" {
+		return bad("unknown version")
+	}
+	s := &OcraSuite{suite: suite}
+	// crypto function: HOTP-SHAx-t
+	cf := strings.Split(parts[1], "-")
+	if len(cf) != 3 || cf[0] != "HOTP" {
+		return bad("invalid crypto function")
+	}
+	switch cf[1] {
+	case "SHA1", "SHA256", "SHA512":
+		s.Algorithm = strings.ToLower(cf[1])
+	default:
+		return bad("unknown algorithm")
+	}
+	var err error
+	if s.Digits, err = strconv.Atoi(cf[2]); err != nil || s.Digits != 0 && (s.Digits < 4 || s.Digits > 10) {
+		return bad("digits must be 0 or 4 to 10")
+	}
+	// data input: [C-]QFxx[-PH|Snnn][-TG]
+	di := strings.Split(parts[2], "-")
+	if di[0] == "C" {
+		s.Counter = true
+		di = di[1:]
+	}
+	if len(di) == 0 || len(di[0]) != 4 || di[0][0] != 'Q' {
+		return bad("invalid question")
+	}
+	switch s.QuestionFormat = di[0][1]; s.QuestionFormat {
+	case OcraQuestionAlpha, OcraQuestionNumeric, OcraQuestionHex:
+	default:
+		return bad("invalid question format")
+	}
+	if s.QuestionLength, err = strconv.Atoi(di[0][2:]); err != nil || s.QuestionLength < 4 || s.QuestionLength > 64 {
+		return bad("question length must be 04 to 64")
+	}
+	di = di[1:]
+	if len(di) > 0 && strings.HasPrefix(di[0], "P") {
+		switch di[0][1:] {
+		case "SHA1", "SHA256", "SHA512":
+			s.PinAlgorithm = strings.ToLower(di[0][1:])
+		default:
+			return bad("unknown PIN algorithm")
+		}
+		di = di[1:]
+	}
+	if len(di) > 0 && strings.HasPrefix(di[0], "S") {
+		switch di[0] {
+		case "S064", "S128", "S256", "S512":
+			s.SessionLength, _ = strconv.Atoi(di[0][1:])
+		default:
+			return bad("invalid session information length")
+		}
+		di = di[1:]
+	}
+	if len(di) > 0 && strings.HasPrefix(di[0], "T") && len(di[0]) >= 3 {
+		n, err := strconv.Atoi(di[0][1 : len(di[0])-1])
+		var limit int
+		switch u := di[0][len(di[0])-1]; u {
+		case 'S':
+			s.TimeStep, limit = time.Second, 59
+		case 'M':
+			s.TimeStep, limit = time.Minute, 59
+		case 'H':
+			s.TimeStep, limit = time.Hour, 48
+		}
+		if err != nil || n < 1 || n > limit {
+			return bad("invalid time step")
+		}
+		s.TimeStep *= time.Duration(n)
+		di = di[1:]
+	}
+	if len(di) != 0 {
+		return bad("unexpected data input " + strings.Join(di, "-"))
+	}
+	return s, nil
+}
+
+// String returns the suite string.
+func (s *OcraSuite) String() string { return s.suite }
+
+// OcraInput holds the inputs for an OCRA computation.
+// Only the inputs included in the suite are used.
+type OcraInput struct {
+	// Counter.
+	Counter uint64
+	// Challenge question, in the format of the suite, up to QuestionLength characters.
+	Question string
+	// Mutual is true for mutual challenge-response, where Question is the client and
+	// server questions concatenated, up to twice QuestionLength characters.
+	Mutual bool
+	// PIN, hashed with the suite's PIN algorithm.
+	Pin string
+	// Hash of the PIN, used when Pin is empty.
+	PinHash []byte
+	// Session information.
+	Session []byte
+	// Time, converted to time steps since the Unix epoch.
+	Time time.Time
+}
+
+// Ocra is an OATH challenge-response (OCRA) key, as specified in RFC 6287.
+type Ocra struct {
+	// The suite
+	*OcraSuite
+	// Secret key
+	Key []byte
+}
+
+// NewOcra creates an *Ocra for the suite with the secret key.
+func NewOcra(suite string, key []byte) (*Ocra, error) {
+	s, err := ParseOcraSuite(suite)
+	if err != nil {
+		return nil, err
+	}
+	return &Ocra{OcraSuite: s, Key: key}, nil
+}
+
+// build the data input
+func (o *Ocra) dataInput(in *OcraInput) ([]byte, error) {
+	bad := func(why string) ([]byte, error) {
+		return nil, &Error{ECInvalidOcraInput, "invalid OCRA input: " + why, nil}
+	}
+	msg := append([]byte(o.suite), 0)
+	// counter
+	if o.Counter {
+		msg = appendUint64(msg, in.Counter)
+	}
+	// question, left aligned and zero padded
+	q, err := o.question(in.Question, in.Mutual)
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, q...)
+	// pin hash
+	if o.PinAlgorithm != "" {
+		h := hashFunc(o.PinAlgorithm)()
+		ph := in.PinHash
+		if in.Pin != "" {
+			h.Write([]byte(in.Pin))
+			ph = h.Sum(nil)
+		}
+		if len(ph) != h.Size() {
+			return bad("missing or invalid PIN hash")
+		}
+		msg = append(msg, ph...)
+	}
+	// session information, right aligned and zero padded
+	if o.SessionLength > 0 {
+		if len(in.Session) > o.SessionLength {
+			return bad("session information too long")
+		}
+		msg = append(msg, make([]byte, o.SessionLength-len(in.Session))...)
+		msg = append(msg, in.Session...)
+	}
+	// timestamp
+	if o.TimeStep > 0 {
+		if in.Time.IsZero() {
+			return bad("missing time")
+		}
+		msg = appendUint64(msg, uint64(in.Time.Unix()/int64(o.TimeStep/time.Second)))
+	}
+	return msg, nil
+}
+
+// append i, big endian
+func appendUint64(b []byte, i uint64) []byte {
+	var c [8]byte
+	binary.BigEndian.PutUint64(c[:], i)
+	return append(b, c[:]...)
+}
+
+// encode the question
+func (o *Ocra) question(q string, mutual bool) ([]byte, error) {
+	bad := func(why string) ([]byte, error) {
+		return nil, &Error{ECInvalidOcraInput, fmt.Sprintf("invalid OCRA question %q: %s", q, why), nil}
+	}
+	if q == "" {
+		return bad("missing question")
+	}
+	// mutual challenge-response concatenates two questions
+	limit := o.QuestionLength
+	if mutual {
+		limit *= 2
+	}
+	if len(q) > limit {
+		return bad(fmt.Sprintf("longer than %d characters", limit))
+	}
+	var (
+		b   []byte
+		err error
+	)
+	switch o.QuestionFormat {
+	case OcraQuestionAlpha:
+		b = []byte(q)
+	case OcraQuestionNumeric:
+		// decimal to hex
+		n, ok := new(big.Int).SetString(q, 10)
+		if !ok || n.Sign() < 0 {
+			return bad("not a number")
+		}
+		h := n.Text(16)
+		if len(h)%2 != 0 {
+			h += "0"
+		}
+		b, err = hex.DecodeString(h)
+	case OcraQuestionHex:
+		if len(q)%2 != 0 {
+			q += "0"
+		}
+		b, err = hex.DecodeString(q)
+	}
+	if err != nil {
+		return bad(err.Error())
+	}
+	if len(b) > ocraQuestionSize {
+		return bad("too long")
+	}
+	r := make([]byte, ocraQuestionSize)
+	copy(r, b)
+	return r, nil
+}
+
+// Compute returns the OCRA response for in, zero padded to Digits.
+// With 0 Digits it's the full HMAC, in lowercase hex.
+func (o *Ocra) Compute(in *OcraInput) (string, error) {
+	msg, err := o.dataInput(in)
+	if err != nil {
+		return "", err
+	}
+	if o.Digits == 0 {
+		hm := hmac.New(hashFunc(o.Algorithm), o.Key)
+		hm.Write(msg)
+		return hex.EncodeToString(hm.Sum(nil)), nil
+	}
+	c := uint64(binary.BigEndian.Uint32(hmacTruncate(hashFunc(o.Algorithm), o.Key, msg)))
+	return formatCode(int(c%uint64(math.Pow10(o.Digits))), o.Digits), nil
+}
+
+// Verify checks the response code for in, in constant time.
+// Spaces and dashes in code are ignored.
+func (o *Ocra) Verify(code string, in *OcraInput) error {
+	c, err := o.Compute(in)
+	if err != nil {
+		return err
+	}
+	code = normalizeCode(code)
+	if o.Digits == 0 {
+		code = strings.ToLower(code)
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(c)) != 1 {
+		return &Error{ECInvalidCode, "invalid code", nil}
+	}
+	return nil
+}
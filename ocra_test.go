@@ -0,0 +1,244 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOcraSuite(t *testing.T) {
+	s, err := ParseOcraSuite("OCRA-1:HOTP-SHA512-8:C-QH40-PSHA256-S128-T1M")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if s.Algorithm != "sha512" || s.Digits != 8 || !s.Counter || s.QuestionFormat != OcraQuestionHex ||
+		s.QuestionLength != 40 || s.PinAlgorithm != "sha256" || s.SessionLength != 128 || s.TimeStep != time.Minute {
+		t.Errorf("got the wrong suite: %+v", s)
+		return
+	}
+	for _, bs := range []string{
+		"",
+		"OCRA-2:HOTP-SHA1-6:QN08",
+		"OCRA-1:TOTP-SHA1-6:QN08",
+		"OCRA-1:HOTP-MD5-6:QN08",
+		"OCRA-1:HOTP-SHA1-3:QN08",
+		"OCRA-1:HOTP-SHA1-11:QN08",
+		"OCRA-1:HOTP-SHA1-6:QX08",
+		"OCRA-1:HOTP-SHA1-6:QN99",
+		"OCRA-1:HOTP-SHA1-6:C",
+		"OCRA-1:HOTP-SHA1-6:QN08-PMD5",
+		"OCRA-1:HOTP-SHA1-6:QN08-S100",
+		"OCRA-1:HOTP-SHA1-6:QN08-T60M",
+		"OCRA-1:HOTP-SHA1-6:QN08-T1M-C",
+	} {
+		if _, err = ParseOcraSuite(bs); !checkError(err, ECInvalidOcraSuite) {
+			t.Error("an error was expected for", bs)
+			return
+		}
+	}
+}
+
+// RFC 6287 appendix C
+func TestOcraRFC6287(t *testing.T) {
+	var (
+		key20 = []byte("12345678901234567890")
+		key32 = []byte("12345678901234567890123456789012")
+		key64 = []byte("1234567890123456789012345678901234567890123456789012345678901234")
+		tm    = time.Unix(0x132d0b6*60, 0)
+	)
+	vectors := []struct {
+		suite string
+		key   []byte
+		in    OcraInput
+		code  string
+	}{
+		// one-way challenge response
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "00000000"}, "237653"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "11111111"}, "243178"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "22222222"}, "653583"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "33333333"}, "740991"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "44444444"}, "608993"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "55555555"}, "388898"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "66666666"}, "816933"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "77777777"}, "224598"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "88888888"}, "750600"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OcraInput{Question: "99999999"}, "294470"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 0, Question: "12345678", Pin: "1234"}, "65347737"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 1, Question: "12345678", Pin: "1234"}, "86775851"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 2, Question: "12345678", Pin: "1234"}, "78192410"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 3, Question: "12345678", Pin: "1234"}, "71565254"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 4, Question: "12345678", Pin: "1234"}, "10104329"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 5, Question: "12345678", Pin: "1234"}, "65983500"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 6, Question: "12345678", Pin: "1234"}, "70069104"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 7, Question: "12345678", Pin: "1234"}, "91771096"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 8, Question: "12345678", Pin: "1234"}, "75011558"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OcraInput{Counter: 9, Question: "12345678", Pin: "1234"}, "08522129"},
+		{"OCRA-1:HOTP-SHA256-8:QN08-PSHA1", key32, OcraInput{Question: "00000000", Pin: "1234"}, "83238735"},
+		{"OCRA-1:HOTP-SHA256-8:QN08-PSHA1", key32, OcraInput{Question: "11111111", Pin: "1234"}, "01501458"},
+		{"OCRA-1:HOTP-SHA256-8:QN08-PSHA1", key32, OcraInput{Question: "22222222", Pin: "1234"}, "17957585"},
+		{"OCRA-1:HOTP-SHA256-8:QN08-PSHA1", key32, OcraInput{Question: "33333333", Pin: "1234"}, "86776967"},
+		{"OCRA-1:HOTP-SHA256-8:QN08-PSHA1", key32, OcraInput{Question: "44444444", Pin: "1234"}, "86807031"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 0, Question: "00000000"}, "07016083"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 1, Question: "11111111"}, "63947962"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 2, Question: "22222222"}, "70123924"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 3, Question: "33333333"}, "25341727"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 4, Question: "44444444"}, "33203315"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 5, Question: "55555555"}, "34205738"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 6, Question: "66666666"}, "44343969"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 7, Question: "77777777"}, "51946085"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 8, Question: "88888888"}, "20403879"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OcraInput{Counter: 9, Question: "99999999"}, "31409299"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", key64, OcraInput{Question: "00000000", Time: tm}, "95209754"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", key64, OcraInput{Question: "11111111", Time: tm}, "55907591"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", key64, OcraInput{Question: "22222222", Time: tm}, "22048402"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", key64, OcraInput{Question: "33333333", Time: tm}, "24218844"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", key64, OcraInput{Question: "44444444", Time: tm}, "36209546"},
+		// mutual challenge response
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "CLI22220SRV11110", Mutual: true}, "28247970"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "CLI22221SRV11111", Mutual: true}, "01984843"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "CLI22222SRV11112", Mutual: true}, "65387857"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "CLI22223SRV11113", Mutual: true}, "03351211"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "CLI22224SRV11114", Mutual: true}, "83412541"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SRV11110CLI22220", Mutual: true}, "15510767"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SRV11111CLI22221", Mutual: true}, "90175646"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SRV11112CLI22222", Mutual: true}, "33777207"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SRV11113CLI22223", Mutual: true}, "95285278"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SRV11114CLI22224", Mutual: true}, "28934924"},
+		{"OCRA-1:HOTP-SHA512-8:QA08", key64, OcraInput{Question: "CLI22220SRV11110", Mutual: true}, "79496648"},
+		{"OCRA-1:HOTP-SHA512-8:QA08", key64, OcraInput{Question: "CLI22221SRV11111", Mutual: true}, "76831980"},
+		{"OCRA-1:HOTP-SHA512-8:QA08", key64, OcraInput{Question: "CLI22222SRV11112", Mutual: true}, "12250499"},
+		{"OCRA-1:HOTP-SHA512-8:QA08", key64, OcraInput{Question: "CLI22223SRV11113", Mutual: true}, "90856481"},
+		{"OCRA-1:HOTP-SHA512-8:QA08", key64, OcraInput{Question: "CLI22224SRV11114", Mutual: true}, "12761449"},
+		{"OCRA-1:HOTP-SHA512-8:QA08-PSHA1", key64, OcraInput{Question: "SRV11110CLI22220", Mutual: true, Pin: "1234"}, "18806276"},
+		{"OCRA-1:HOTP-SHA512-8:QA08-PSHA1", key64, OcraInput{Question: "SRV11111CLI22221", Mutual: true, Pin: "1234"}, "70020315"},
+		{"OCRA-1:HOTP-SHA512-8:QA08-PSHA1", key64, OcraInput{Question: "SRV11112CLI22222", Mutual: true, Pin: "1234"}, "01600026"},
+		{"OCRA-1:HOTP-SHA512-8:QA08-PSHA1", key64, OcraInput{Question: "SRV11113CLI22223", Mutual: true, Pin: "1234"}, "18951020"},
+		{"OCRA-1:HOTP-SHA512-8:QA08-PSHA1", key64, OcraInput{Question: "SRV11114CLI22224", Mutual: true, Pin: "1234"}, "32528969"},
+		// plain signature
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SIG10000"}, "53095496"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SIG11000"}, "04110475"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SIG12000"}, "31331128"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SIG13000"}, "76028668"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OcraInput{Question: "SIG14000"}, "46554205"},
+		{"OCRA-1:HOTP-SHA512-8:QA10-T1M", key64, OcraInput{Question: "SIG1000000", Time: tm}, "77537423"},
+		{"OCRA-1:HOTP-SHA512-8:QA10-T1M", key64, OcraInput{Question: "SIG1100000", Time: tm}, "31970405"},
+		{"OCRA-1:HOTP-SHA512-8:QA10-T1M", key64, OcraInput{Question: "SIG1200000", Time: tm}, "10235557"},
+		{"OCRA-1:HOTP-SHA512-8:QA10-T1M", key64, OcraInput{Question: "SIG1300000", Time: tm}, "95213541"},
+		{"OCRA-1:HOTP-SHA512-8:QA10-T1M", key64, OcraInput{Question: "SIG1400000", Time: tm}, "65360607"},
+	}
+	for _, v := range vectors {
+		o, err := NewOcra(v.suite, v.key)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if c, err := o.Compute(&v.in); err != nil {
+			t.Error(err)
+			return
+		} else if c != v.code {
+			t.Error("got the wrong code for", v.suite, v.in.Question, "expected:", v.code, "got:", c)
+		}
+	}
+}
+
+func TestOcraVerify(t *testing.T) {
+	o, err := NewOcra("OCRA-1:HOTP-SHA256-8:QN08-PSHA1", []byte("12345678901234567890123456789012"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	in := &OcraInput{Question: "00000000", Pin: "1234"}
+	if err = o.Verify("8323-8735", in); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = o.Verify("83238736", in); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+	// pin hash instead of pin
+	ph := []byte{0x71, 0x10, 0xed, 0xa4, 0xd0, 0x9e, 0x06, 0x2a, 0xa5, 0xe4, 0xa3, 0x90, 0xb0, 0xa5, 0x72, 0xac, 0x0d, 0x2c, 0x02, 0x20}
+	if err = o.Verify("83238735", &OcraInput{Question: "00000000", PinHash: ph}); err != nil {
+		t.Error(err)
+		return
+	}
+	// bad inputs
+	for _, in := range []*OcraInput{
+		{Question: "00000000"},
+		{Question: ""},
+		{Question: "abc", Pin: "1234"},
+		{Question: "123456789", Pin: "1234"},
+		{Question: "1234567812345678", Pin: "1234"},
+		{Question: "12345678123456781", Pin: "1234", Mutual: true},
+	} {
+		if _, err = o.Compute(in); !checkError(err, ECInvalidOcraInput) {
+			t.Error("got the wrong error for", in)
+			return
+		}
+	}
+	// mutual challenge-response, up to twice the question length
+	if _, err = o.Compute(&OcraInput{Question: "1234567812345678", Pin: "1234", Mutual: true}); err != nil {
+		t.Error(err)
+		return
+	}
+	// no truncation
+	o0, err := NewOcra("OCRA-1:HOTP-SHA1-0:QN08", []byte("12345678901234567890"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	c, err := o0.Compute(&OcraInput{Question: "00000000"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	o6, _ := NewOcra("OCRA-1:HOTP-SHA1-6:QN08", []byte("12345678901234567890"))
+	msg, _ := o0.dataInput(&OcraInput{Question: "00000000"})
+	if want := hmacHex(o0.Key, msg); c != want {
+		t.Error("expected the full HMAC", want, "got:", c)
+		return
+	}
+	if err = o0.Verify(strings.ToUpper(c), &OcraInput{Question: "00000000"}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = o6.Verify(c, &OcraInput{Question: "00000000"}); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+	// session information and time
+	if o, err = NewOcra("OCRA-1:HOTP-SHA1-6:QH08-S064-T30S", []byte("12345678901234567890")); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = o.Compute(&OcraInput{Question: "0a1b2c3d", Session: []byte("s")}); !checkError(err, ECInvalidOcraInput) {
+		t.Error("got the wrong error")
+		return
+	}
+	if _, err = o.Compute(&OcraInput{Question: "0a1b2c3d", Session: make([]byte, 65), Time: time.Unix(60, 0)}); !checkError(err, ECInvalidOcraInput) {
+		t.Error("got the wrong error")
+		return
+	}
+	c1, err := o.Compute(&OcraInput{Question: "0a1b2c3d", Session: []byte("s1"), Time: time.Unix(60, 0)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	c2, _ := o.Compute(&OcraInput{Question: "0a1b2c3d", Session: []byte("s2"), Time: time.Unix(60, 0)})
+	c3, _ := o.Compute(&OcraInput{Question: "0a1b2c3d", Session: []byte("s1"), Time: time.Unix(89, 0)})
+	if c1 == c2 || c1 != c3 {
+		t.Error("session or time step not applied:", c1, c2, c3)
+		return
+	}
+}
+
+// full HMAC-SHA1 of msg, in hex
+func hmacHex(key, msg []byte) string {
+	hm := hmac.New(sha1.New, key)
+	hm.Write(msg)
+	return hex.EncodeToString(hm.Sum(nil))
+}
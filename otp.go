@@ -13,9 +13,12 @@ import (
 	"encoding/binary"
 	"fmt"
 	"hash"
+	"log/slog"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // Types of OTP auth supported.
@@ -28,77 +31,127 @@ const (
 const (
 	DefaultDigits    = 6      // 6 digit code.
 	DefaultKeyLength = 10     // 10 bytes (16 base32 characters).
-	DefaultAlgorithm = "sha1" // SHA1 is the only supported.
+	DefaultAlgorithm = "sha1" // SHA1 is the default, SHA256 and SHA512 are also supported.
 )
 
-// Error codes.
-const (
-	// Common errors for TOTP and HOTP.
-	ECMissingLabel     = iota // Missing (or empty) label.
-	ECInvalidAlgorithm        // Invalid algorithm.
-	ECCantReadRandom          // Something went wrong while reading random bytes.
-	ECNotEnoughRandom         // Didn't read enough random bytes.
-	ECUrlParseError           // Error parsing the url.
-	ECWrongScheme             // Url scheme != "otpauth".
-	ECInvalidOtpType          // Host in the url must be either "totp" or "hotp".
-	ECBase32Decoding          // Base32 decoding error.
-	ECInvalidDigits           // Invalid number of digits.
-	ECMissingSecret           // Secret parameter is missing.
-
-	// HOTP specific errors.
-	ECNotHotp        // Url is not HOTP.
-	ECMissingCounter // Counter parameter is missing.
-	ECInvalidCounter // Can't parse counter.
-
-	// TOTP specific errors.
-	ECNotTotp       // Url is not TOTP.
-	ECInvalidPeriod // Can't parse period parameter.
-)
-
-// Error is a common error struct returned by new/import functions.
-type Error struct {
-	// The field Code can hold any of the EC* error codes.
-	Code int
-	// The field Desc is a description of the error.
-	Desc string
-	// The field Err holds the original error if any.
-	Err error
-}
-
-// Implement error.
-func (g *Error) Error() string {
-	var (
-		f = "%v"
-		a = []interface{}{g.Desc}
-	)
-	if g.Err != nil {
-		f += ": %v"
-		a = append(a, g.Err.Error())
-	}
-	return fmt.Sprintf(f, a...)
-}
-
 // Common OTP fields.
 type Common struct {
 	// Secret key. Required.
 	Key []byte
-	// Label. Required.
-	Label string
+	// Account name, the label without the issuer prefix. Required.
+	AccountName string
 	// Issuer. Not required but recommended.
 	Issuer string
-	// Algorithm. Only SHA1.
+	// Algorithm. SHA1, SHA256 or SHA512.
 	Algorithm string
 	// Digits. Usually 6 or 8.
 	Digits int
+	// Other url parameters, like image, kept so that Url() doesn't lose them.
+	Params url.Values
+	// Label is the full label, as returned by FullLabel, set when the key is created or imported.
+	// It's only read when AccountName is empty, for keys built before AccountName existed.
+	//
+	// Deprecated: use AccountName and Issuer.
+	Label string
+}
+
+// FullLabel returns the label in the recommended form, "Issuer:AccountName", or
+// just the account name when there's no issuer.
+func (k *Common) FullLabel() string {
+	issuer, account := k.names()
+	if issuer == "" {
+		return account
+	}
+	return issuer + ":" + account
+}
+
+// issuer and account name, from Label if AccountName is empty
+func (k *Common) names() (string, string) {
+	if k.AccountName == "" && k.Label != "" {
+		if issuer, account, err := parseLabel(k.Label, k.Issuer); err == nil {
+			return issuer, account
+		}
+		return k.Issuer, k.Label
+	}
+	return k.Issuer, k.AccountName
+}
+
+// String returns the label, never the secret.
+func (k Common) String() string { return k.FullLabel() }
+
+// GoString returns the fields of the key with the secret redacted.
+func (k Common) GoString() string {
+	return fmt.Sprintf("&otp.Common{Key:%s, AccountName:%q, Issuer:%q, Algorithm:%q, Digits:%d, Params:%#v}",
+		redacted, k.AccountName, k.Issuer, k.Algorithm, k.Digits, k.Params)
+}
+
+// LogValue implements slog.LogValuer, logging everything but the secret.
+func (k Common) LogValue() slog.Value { return slog.GroupValue(k.logAttrs()...) }
+
+// attributes for slog, never the secret
+func (k Common) logAttrs() []slog.Attr {
+	return []slog.Attr{
+		slog.String("issuer", k.Issuer),
+		slog.String("account", k.AccountName),
+		slog.String("algorithm", k.Algorithm),
+		slog.Int("digits", k.Digits),
+	}
+}
+
+// replaces the secret in String, GoString and logs
+const redacted = "REDACTED"
+
+// replace the secret of an otpauth url
+func redactUrl(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return redacted
+	}
+	q := pu.Query()
+	q.Set("secret", redacted)
+	pu.RawQuery = q.Encode()
+	return pu.String()
+}
+
+// url parse error without the url, url.Error has the whole url, secret included
+func urlParseError(err error) *Error {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	return &Error{ECUrlParseError, "can't parse url", err}
 }
 
-// func (k* otpKey)
+// split the label in issuer and account name, the issuer prefix must match issuer if both are set.
+// Neither can contain a colon, or the label couldn't be split again.
+func parseLabel(label, issuer string) (string, string, error) {
+	account := label
+	if i := strings.Index(label, ":"); i >= 0 {
+		prefix := label[:i]
+		// spaces are allowed after the colon
+		account = strings.TrimLeft(label[i+1:], " ")
+		if issuer == "" {
+			issuer = prefix
+		} else if prefix != issuer {
+			return "", "", &Error{ECIssuerMismatch, fmt.Sprintf("label issuer %q doesn't match issuer %q", prefix, issuer), nil}
+		}
+	}
+	// account name is required
+	if account == "" {
+		return "", "", &Error{ECMissingLabel, "must provide a label", nil}
+	}
+	if strings.Contains(issuer, ":") || strings.Contains(account, ":") {
+		return "", "", &Error{ECInvalidLabel, fmt.Sprintf("issuer %q or account name %q contains a colon", issuer, account), nil}
+	}
+	return issuer, account, nil
+}
 
-// Create a new *otpKey.
+// Create a new *Common.
+// label may have an issuer prefix, "Issuer:AccountName".
 func newCommon(keyLen int, label, issuer, algorithm string, digits int) (*Common, error) {
 	// label is required
-	if label == "" {
-		return nil, &Error{ECMissingLabel, "must provide a label", nil}
+	issuer, account, err := parseLabel(label, issuer)
+	if err != nil {
+		return nil, err
 	}
 	// default for digits
 	d := DefaultDigits
@@ -125,22 +178,24 @@ func newCommon(keyLen int, label, issuer, algorithm string, digits int) (*Common
 	} else if n != kl {
 		return nil, &Error{ECNotEnoughRandom, "couldn't read enough random bytes", nil}
 	}
-	return &Common{
-		Key:       b,
-		Label:     label,
-		Issuer:    issuer,
-		Algorithm: a,
-		Digits:    d,
-	}, nil
+	k := &Common{
+		Key:         b,
+		AccountName: account,
+		Issuer:      issuer,
+		Algorithm:   a,
+		Digits:      d,
+	}
+	k.Label = k.FullLabel()
+	return k, nil
 }
 
-// Import otpauth url.
-func importCommon(u string) (k *Common, typ string, params url.Values, err error) {
+// Import otpauth url. strict only accepts padded, uppercase, base32 secrets.
+func importCommon(u string, strict bool) (k *Common, typ string, params url.Values, err error) {
 	// parse and check scheme and host
 	var otpUrl *url.URL
 	otpUrl, err = url.Parse(u)
 	if err != nil {
-		err = &Error{ECUrlParseError, fmt.Sprintf("can't parse url: %v", err.Error()), err}
+		err = urlParseError(err)
 	} else if otpUrl.Scheme != "otpauth" {
 		err = &Error{ECWrongScheme, fmt.Sprintf("bad scheme: %s", otpUrl.Scheme), nil}
 	} else {
@@ -155,23 +210,16 @@ func importCommon(u string) (k *Common, typ string, params url.Values, err error
 	}
 	// set OTP type
 	typ = otpUrl.Host
-	k = &Common{
-		Label:  strings.TrimPrefix(otpUrl.Path, "/"),
-		Digits: DefaultDigits,
-	}
+	k = &Common{Digits: DefaultDigits}
 	// parse url parameters
 	params = url.Values{}
 	for name, vals := range otpUrl.Query() {
 		switch n := strings.ToLower(name); n {
 		case "secret":
 			// base32 secret key
-			var b []byte
-			b, err = base32.StdEncoding.DecodeString(vals[0])
-			if err != nil {
-				err = &Error{ECBase32Decoding, fmt.Sprintf("can't decode base32 key: %v", err.Error()), err}
+			if k.Key, err = decodeKey32(vals[0], strict); err != nil {
 				return
 			}
-			k.Key = b
 		case "digits":
 			// number of digits
 			if k.Digits, err = strconv.Atoi(vals[0]); err != nil {
@@ -192,39 +240,112 @@ func importCommon(u string) (k *Common, typ string, params url.Values, err error
 			k.Issuer = vals[0]
 		default:
 			// other parameters will be returned to the caller
-			params.Set(name, vals[0])
+			params[name] = vals
 		}
 	}
 	// secret is required and was not provided
-	if k.Key == nil {
+	if len(k.Key) == 0 {
 		err = &Error{ECMissingSecret, "the secret parameter is required", nil}
 		return
 	}
+	// the path is already unescaped, so an encoded colon (%3A) also separates the issuer
+	if k.Issuer, k.AccountName, err = parseLabel(strings.TrimPrefix(otpUrl.Path, "/"), k.Issuer); err == nil {
+		k.Label = k.FullLabel()
+	}
 	return
 }
 
-// Key32 returns the Key field encoded in base32.
-func (k *Common) Key32() string { return base32.StdEncoding.EncodeToString(k.Key) }
+// Key32 returns the Key field encoded in base32, without padding.
+func (k *Common) Key32() string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(k.Key)
+}
+
+// Key32Padded returns the Key field encoded in base32, with padding.
+func (k *Common) Key32Padded() string { return base32.StdEncoding.EncodeToString(k.Key) }
 
 // SetKey32 sets the Key field from a base32 string.
-func (k *Common) SetKey32(key string) error {
-	var err error
-	if k.Key, err = base32.StdEncoding.DecodeString(key); err != nil {
-		return &Error{ECBase32Decoding, fmt.Sprintf("can't decode base32 key: %v", err.Error()), err}
+// Lowercase, missing padding, spaces and dashes are accepted.
+func (k *Common) SetKey32(key string) error { return k.setKey32(key, false) }
+
+// SetKey32Strict sets the Key field from a padded, uppercase, base32 string.
+func (k *Common) SetKey32Strict(key string) error { return k.setKey32(key, true) }
+
+// set the key from a base32 string, the Key field is unchanged on errors
+func (k *Common) setKey32(key string, strict bool) error {
+	b, err := decodeKey32(key, strict)
+	if err != nil {
+		return err
+	}
+	k.Key = b
+	return nil
+}
+
+// decode a base32 key
+func decodeKey32(key string, strict bool) ([]byte, error) {
+	enc := base32.StdEncoding
+	if !strict {
+		// authenticator apps group the characters and omit the padding
+		key = strings.Map(func(r rune) rune {
+			if r == '-' || r == '=' || unicode.IsSpace(r) {
+				return -1
+			}
+			return unicode.ToUpper(r)
+		}, key)
+		enc = enc.WithPadding(base32.NoPadding)
+	}
+	b, err := enc.DecodeString(key)
+	if err != nil {
+		return nil, &Error{ECBase32Decoding, fmt.Sprintf("can't decode base32 key: %v", err.Error()), err}
+	}
+	return b, nil
+}
+
+// check that the fields make an otpauth url that imports back
+func (k *Common) validate() error {
+	if len(k.Key) == 0 {
+		return &Error{ECMissingSecret, "the secret is required", nil}
+	}
+	if hashFunc(k.Algorithm) == nil {
+		return &Error{ECInvalidAlgorithm, fmt.Sprintf("unknown algorithm: %v", k.Algorithm), nil}
+	}
+	// the codes are 31 bit numbers
+	if k.Digits < 1 || k.Digits > 10 {
+		return &Error{ECInvalidDigits, fmt.Sprintf("invalid digits: %v", k.Digits), nil}
+	}
+	issuer, account := k.names()
+	if account == "" {
+		return &Error{ECMissingLabel, "must provide a label", nil}
+	}
+	if strings.Contains(issuer, ":") || strings.Contains(account, ":") {
+		return &Error{ECInvalidLabel, fmt.Sprintf("issuer %q or account name %q contains a colon", issuer, account), nil}
 	}
 	return nil
 }
 
-// Return an otpauth url.
-func (k *Common) url(otpType string, params url.Values) string {
+// Return an otpauth url, with a padded secret if padded.
+func (k *Common) url(otpType string, params url.Values, padded bool) string {
 	// check otp type
 	switch otpType {
 	case TypeTotp, TypeHotp:
 	default:
 		panic("bad otp type. only totp and hotp allowed.")
 	}
+	// unknown parameters first, so they can't override the others
+	for name, vals := range k.Params {
+		switch strings.ToLower(name) {
+		case "secret", "digits", "algorithm", "issuer":
+			continue
+		}
+		if _, ok := params[name]; !ok {
+			params[name] = append([]string(nil), vals...)
+		}
+	}
 	// add url parameters
-	params.Set("secret", k.Key32())
+	if padded {
+		params.Set("secret", k.Key32Padded())
+	} else {
+		params.Set("secret", k.Key32())
+	}
 	if k.Digits != DefaultDigits {
 		params.Set("digits", strconv.Itoa(k.Digits))
 	}
@@ -237,50 +358,91 @@ func (k *Common) url(otpType string, params url.Values) string {
 		panic("do not mess with the algorithm")
 	}
 	// include issuer ?
-	if k.Issuer != "" {
-		params.Set("issuer", k.Issuer)
+	if issuer, _ := k.names(); issuer != "" {
+		params.Set("issuer", issuer)
 	}
 	// url.URL plays nice with otpauth urls
 	u := &url.URL{
 		Scheme:   "otpauth",
 		Host:     otpType,
-		Path:     "/" + k.Label,
+		Path:     "/" + k.FullLabel(),
 		RawQuery: params.Encode(),
 	}
 	return u.String()
 }
 
+// keep the parameters that weren't consumed by the key type, nil if none
+func (k *Common) setParams(params url.Values, consumed ...string) {
+	k.Params = nil
+	for name, vals := range params {
+		if slices.Contains(consumed, name) {
+			continue
+		}
+		if k.Params == nil {
+			k.Params = url.Values{}
+		}
+		k.Params[name] = append([]string(nil), vals...)
+	}
+}
+
 // hashing and truncation
 func (k *Common) hashTruncateInt(i int) []byte {
-	var sha func() hash.Hash
-	switch a := strings.ToLower(k.Algorithm); a {
-	case "", "sha1":
-		sha = sha1.New
-	case "sha256":
-		sha = sha256.New
-	case "sha512":
-		sha = sha512.New
-	default:
+	sha := hashFunc(k.Algorithm)
+	if sha == nil {
 		panic("don't mess with the algorithm")
 	}
 	b := make([]byte, 8)
 	binary.BigEndian.PutUint64(b, uint64(i))
-	hm := hmac.New(sha, k.Key)
-	if _, err := hm.Write(b); err != nil {
+	return hmacTruncate(sha, k.Key, b)
+}
+
+// returns the hash function for algorithm, nil if it's not supported
+func hashFunc(algorithm string) func() hash.Hash {
+	switch a := strings.ToLower(algorithm); a {
+	case "", "sha1":
+		return sha1.New
+	case "sha256":
+		return sha256.New
+	case "sha512":
+		return sha512.New
+	}
+	return nil
+}
+
+// hmac of msg and dynamic truncation
+func hmacTruncate(sha func() hash.Hash, key, msg []byte) []byte {
+	hm := hmac.New(sha, key)
+	if _, err := hm.Write(msg); err != nil {
 		panic(err)
 	}
-	b = hm.Sum(nil)
-	ofs := int(b[19] & 0xf)
+	b := hm.Sum(nil)
+	// the offset is the low nibble of the last byte (RFC 4226 5.3, RFC 6238 1.2)
+	ofs := int(b[len(b)-1] & 0xf)
 	c := make([]byte, 4)
 	copy(c, b[ofs:ofs+4])
 	c[0] = c[0] & 0x7f
 	return c
 }
 
+// format a code with leading zeros
+func formatCode(c, digits int) string { return fmt.Sprintf("%0*d", digits, c) }
+
+// remove the spaces and dashes users type or paste along with codes
+func normalizeCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, code)
+}
+
 // Key represents an OTP key.
 type Key interface {
 	Code() int
 	CodeN(n int) int
+	CodeString() string
+	CodeNString(n int) string
 	Key32() string
 	SetKey32(string) error
 	Url() string
@@ -290,28 +452,27 @@ type Key interface {
 
 // NewKey creates a new OTP key.
 // keyType must be either TypeTotp or TypeHotp.
-// label is required. keyLen <= 0, defaults to 10.
+// label is required, an issuer prefix ("Issuer:AccountName") must match issuer. keyLen <= 0, defaults to 10.
 // algorithm == "", defaults to "sha1".
 // digits <= 0, defaults to 6
+// extraParams other than counter, period and t0 are kept in Params.
 func NewKey(keyType string, keyLen int, label, issuer, algorithm string, digits int, extraParams url.Values) (Key, error) {
 	switch keyType {
 	case TypeTotp:
 		// TOTP
-		// parse period parameter
-		p := extraParams.Get("period")
-		var (
-			err error
-			pp  int
-		)
-		if p != "" {
-			pp, err = strconv.Atoi(p)
-			if err != nil {
-				return nil, &Error{ECInvalidPeriod, fmt.Sprintf("invalid period: %v", p), err}
-			} else if pp == 0 {
-				pp = DefaultPeriod
-			}
+		// parse period and t0 parameters
+		// period=0 defaults to 30 seconds
+		p, t0, err := parseTotpParams(extraParams, true)
+		if err != nil {
+			return nil, err
 		}
-		return NewTotp(keyLen, label, issuer, algorithm, digits, pp)
+		k, err := NewTotp(keyLen, label, issuer, algorithm, digits, p)
+		if err != nil {
+			return nil, err
+		}
+		k.T0 = t0
+		k.setParams(extraParams, totpParams...)
+		return k, nil
 	case TypeHotp:
 		// HOTP
 		// check for counter parameter
@@ -323,7 +484,12 @@ func NewKey(keyType string, keyLen int, label, issuer, algorithm string, digits
 		if err != nil {
 			return nil, &Error{ECInvalidCounter, fmt.Sprintf("bad counter: %v", c), err}
 		}
-		return NewHotp(keyLen, label, issuer, algorithm, digits, cc)
+		k, err := NewHotp(keyLen, label, issuer, algorithm, digits, cc)
+		if err != nil {
+			return nil, err
+		}
+		k.setParams(extraParams, hotpParams...)
+		return k, nil
 	default:
 		return nil, &Error{ECInvalidOtpType, fmt.Sprintf("invalid OTP authentication type: %v", keyType), nil}
 	}
@@ -335,8 +501,15 @@ func NewKeyWithDefaults(keyType, label, issuer string, extraParams url.Values) (
 }
 
 // Import an OTP key from an otpauth url.
-func ImportKey(u string) (Key, error) {
-	k, typ, args, err := importCommon(u)
+// Lowercase, unpadded, secrets with spaces or dashes are accepted.
+func ImportKey(u string) (Key, error) { return importKey(u, false) }
+
+// ImportKeyStrict imports an OTP key from an otpauth url with a padded, uppercase, base32 secret.
+func ImportKeyStrict(u string) (Key, error) { return importKey(u, true) }
+
+// import an otpauth url
+func importKey(u string, strict bool) (Key, error) {
+	k, typ, args, err := importCommon(u, strict)
 	if err != nil {
 		return nil, err
 	}
@@ -346,8 +519,12 @@ func ImportKey(u string) (Key, error) {
 	return importHotp(k, args)
 }
 
-// ensure that we implement Key in Totp and Hotp
+// ensure that we implement Key in Totp and Hotp, and keep the secrets out of fmt and slog
 var (
-	_ Key = (*Totp)(nil)
-	_ Key = (*Hotp)(nil)
+	_ Key            = (*Totp)(nil)
+	_ Key            = (*Hotp)(nil)
+	_ fmt.GoStringer = (*Totp)(nil)
+	_ fmt.GoStringer = (*Hotp)(nil)
+	_ slog.LogValuer = (*Totp)(nil)
+	_ slog.LogValuer = (*Hotp)(nil)
 )
@@ -1,11 +1,15 @@
 package otp
 
 import (
+	"bytes"
+	"fmt"
+	"log/slog"
 	"net/url"
+	"strings"
 	"testing"
 )
 
-func checkError(err error, code int) bool {
+func checkError(err error, code ErrorCode) bool {
 	if e, ok := err.(*Error); ok {
 		return e.Code == code
 	}
@@ -28,7 +32,7 @@ func TestOtp(t *testing.T) {
 		t.Error("got the wrong error")
 		return
 	}
-	checkImport := func(u string, ec int) bool {
+	checkImport := func(u string, ec ErrorCode) bool {
 		if _, err := ImportKey(u); err == nil {
 			t.Error("an error was expected")
 			return false
@@ -40,7 +44,7 @@ func TestOtp(t *testing.T) {
 	}
 	badUrls := []struct {
 		u  string
-		ec int
+		ec ErrorCode
 	}{
 		// check for bad authentication type
 		{"otpauth://asdad/mydomain.com?secret=ADS2OR6Q6K3OJZDW", ECInvalidOtpType},
@@ -74,7 +78,7 @@ func TestOtp(t *testing.T) {
 		t.Error("got the wrong error")
 		return
 	}
-	checkNew := func(typ string, args url.Values, ec int) bool {
+	checkNew := func(typ string, args url.Values, ec ErrorCode) bool {
 		if _, err := NewKeyWithDefaults(typ, "mydomain.com", "", args); err == nil {
 			t.Error("an error was expected")
 			return false
@@ -87,9 +91,10 @@ func TestOtp(t *testing.T) {
 	badArgs := []struct {
 		t  string
 		a  url.Values
-		ec int
+		ec ErrorCode
 	}{
 		{TypeTotp, url.Values{"period": []string{"asd"}}, ECInvalidPeriod},
+		{TypeTotp, url.Values{"period": []string{"-30"}}, ECInvalidPeriod},
 		{TypeHotp, url.Values{}, ECMissingCounter},
 		{TypeHotp, url.Values{"counter": []string{"asd"}}, ECInvalidCounter},
 		{"invalid", url.Values{}, ECInvalidOtpType},
@@ -99,4 +104,334 @@ func TestOtp(t *testing.T) {
 			return
 		}
 	}
+	// period=0 defaults to 30 seconds
+	if k, err := NewKeyWithDefaults(TypeTotp, "mydomain.com", "", url.Values{"period": []string{"0"}}); err != nil {
+		t.Error(err)
+		return
+	} else if kt := k.(*Totp); kt.Period != DefaultPeriod {
+		t.Error("wrong period:", kt.Period)
+		return
+	}
+}
+
+func TestLabel(t *testing.T) {
+	for _, v := range []struct {
+		u, issuer, account, label string
+	}{
+		{"otpauth://totp/alice@example.com?secret=ADS2OR6Q6K3OJZDW", "", "alice@example.com", "alice@example.com"},
+		{"otpauth://totp/Example:alice@example.com?secret=ADS2OR6Q6K3OJZDW", "Example", "alice@example.com", "Example:alice@example.com"},
+		{"otpauth://totp/Example%3Aalice@example.com?secret=ADS2OR6Q6K3OJZDW&issuer=Example", "Example", "alice@example.com", "Example:alice@example.com"},
+		{"otpauth://totp/Big%20Corp:%20alice?secret=ADS2OR6Q6K3OJZDW&issuer=Big+Corp", "Big Corp", "alice", "Big Corp:alice"},
+		{"otpauth://hotp/alice?secret=ADS2OR6Q6K3OJZDW&issuer=Example&counter=0", "Example", "alice", "Example:alice"},
+	} {
+		k, err := ImportKey(v.u)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var c *Common
+		switch kk := k.(type) {
+		case *Totp:
+			c = kk.Common
+		case *Hotp:
+			c = kk.Common
+		}
+		if c.Issuer != v.issuer || c.AccountName != v.account || c.FullLabel() != v.label || c.Label != v.label {
+			t.Error("wrong issuer, account name or label:", c.Issuer, c.AccountName, c.FullLabel(), c.Label)
+			return
+		}
+		// the recommended form is emitted, and imports back the same
+		u, err := url.Parse(k.Url())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if u.Path != "/"+v.label || u.Query().Get("issuer") != v.issuer {
+			t.Error("wrong url:", k.Url())
+			return
+		}
+		if k2, err := ImportKey(k.Url()); err != nil {
+			t.Error(err)
+			return
+		} else if k2.Url() != k.Url() {
+			t.Error("different urls:", k.Url(), k2.Url())
+			return
+		}
+	}
+	for _, u := range []string{
+		"otpauth://totp/Example:alice?secret=ADS2OR6Q6K3OJZDW&issuer=Other",
+		"otpauth://totp/Example%3Aalice?secret=ADS2OR6Q6K3OJZDW&issuer=Other",
+	} {
+		if _, err := ImportKey(u); !checkError(err, ECIssuerMismatch) {
+			t.Error("got the wrong error:", err)
+			return
+		}
+	}
+	if _, err := ImportKey("otpauth://totp/Example:?secret=ADS2OR6Q6K3OJZDW"); !checkError(err, ECMissingLabel) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	// colons in the issuer or the account name wouldn't survive the round trip
+	for _, u := range []string{
+		"otpauth://totp/alice?issuer=A%3AB&secret=ADS2OR6Q6K3OJZDW",
+		"otpauth://totp/A:B:alice?secret=ADS2OR6Q6K3OJZDW",
+		"otpauth://totp/A:B:alice?issuer=A&secret=ADS2OR6Q6K3OJZDW",
+		"otpauth://totp/a%3Ab%3Ac?secret=ADS2OR6Q6K3OJZDW",
+	} {
+		if _, err := ImportKey(u); !checkError(err, ECInvalidLabel) {
+			t.Error("got the wrong error for", u, err)
+			return
+		}
+	}
+	for _, v := range [][2]string{{"alice", "A:B"}, {"a:b:c", ""}, {"Example:a:b", "Example"}} {
+		if _, err := NewTotpWithDefaults(v[0], v[1]); !checkError(err, ECInvalidLabel) {
+			t.Error("got the wrong error for", v, err)
+			return
+		}
+	}
+	// new keys
+	k, err := NewTotpWithDefaults("Example:alice", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if k.Issuer != "Example" || k.AccountName != "alice" {
+		t.Error("wrong issuer or account name:", k.Issuer, k.AccountName)
+		return
+	}
+	if _, err = NewHotpWithDefaults("Example:alice", "Other"); !checkError(err, ECIssuerMismatch) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	if k.Label != "Example:alice" {
+		t.Error("wrong label:", k.Label)
+		return
+	}
+	// keys built with the deprecated Label field
+	kl := &Totp{Common: &Common{Key: k.Key, Label: "Example:alice", Digits: DefaultDigits}, Period: DefaultPeriod}
+	if kl.Url() != k.Url() || kl.String() != k.String() {
+		t.Error("wrong url:", kl.Url())
+		return
+	}
+	b, err := kl.MarshalBinary()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kl2 := &Totp{}
+	if err = kl2.UnmarshalBinary(b); err != nil {
+		t.Error(err)
+		return
+	} else if kl2.Issuer != "Example" || kl2.AccountName != "alice" {
+		t.Error("wrong issuer or account name:", kl2.Issuer, kl2.AccountName)
+		return
+	}
+}
+
+func TestKey32(t *testing.T) {
+	k := &Common{}
+	for _, s := range []string{
+		"JBSWY3DPEHPK3PXP",
+		"jbsw y3dp ehpk 3pxp",
+		"JBSW-Y3DP-EHPK-3PXP",
+		"jbswy3dpehpk3pxp\n",
+	} {
+		if err := k.SetKey32(s); err != nil {
+			t.Error(err)
+			return
+		}
+		if string(k.Key) != "Hello!\xde\xad\xbe\xef" {
+			t.Errorf("wrong key for %q: %x", s, k.Key)
+			return
+		}
+	}
+	// 26 characters, with and without padding
+	for _, s := range []string{"GEZDGNBVGY3TQOJQGEZDGNBVGY", "GEZDGNBVGY3TQOJQGEZDGNBVGY======"} {
+		if err := k.SetKey32(s); err != nil {
+			t.Error(err)
+			return
+		}
+		if string(k.Key) != "1234567890123456" {
+			t.Errorf("wrong key for %q: %x", s, k.Key)
+			return
+		}
+	}
+	if k.Key32() != "GEZDGNBVGY3TQOJQGEZDGNBVGY" || k.Key32Padded() != "GEZDGNBVGY3TQOJQGEZDGNBVGY======" {
+		t.Error("wrong base32 key:", k.Key32(), k.Key32Padded())
+		return
+	}
+	// strict mode
+	for _, s := range []string{"GEZDGNBVGY3TQOJQGEZDGNBVGY", "jbswy3dpehpk3pxp", "JBSW Y3DP EHPK 3PXP"} {
+		if err := k.SetKey32Strict(s); !checkError(err, ECBase32Decoding) {
+			t.Errorf("got the wrong error for %q: %v", s, err)
+			return
+		}
+	}
+	if string(k.Key) != "1234567890123456" {
+		t.Error("the key shouldn't change on errors")
+		return
+	}
+	if err := k.SetKey32Strict("GEZDGNBVGY3TQOJQGEZDGNBVGY======"); err != nil {
+		t.Error(err)
+		return
+	}
+	// urls
+	const u = "otpauth://totp/alice?secret=gezd+gnbv+gy3t+qojq+gezd+gnbv+gy"
+	k2, err := ImportKey(u)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if k2.Url() != "otpauth://totp/alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY" {
+		t.Error("wrong url:", k2.Url())
+		return
+	}
+	if _, err = ImportKeyStrict(u); !checkError(err, ECBase32Decoding) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	const padded = "otpauth://totp/alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY%3D%3D%3D%3D%3D%3D"
+	if _, err = ImportKeyStrict(padded); err != nil {
+		t.Error(err)
+		return
+	}
+	// typed imports
+	if _, err = ImportTotpStrict(u); !checkError(err, ECBase32Decoding) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	kt, err := ImportTotpStrict(padded)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if kt.UrlPadded() != padded {
+		t.Error("wrong padded url:", kt.UrlPadded())
+		return
+	}
+	const hu = "otpauth://hotp/alice?counter=3&secret=gezdgnbvgy3tqojqgezdgnbvgy"
+	if _, err = ImportHotpStrict(hu); !checkError(err, ECBase32Decoding) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	kh, err := ImportHotp(hu)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = ImportHotpStrict(kh.UrlPadded()); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = ImportHotpStrict(kt.UrlPadded()); !checkError(err, ECNotHotp) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+}
+
+func TestParams(t *testing.T) {
+	const u = "otpauth://totp/Example:alice?secret=ADS2OR6Q6K3OJZDW&issuer=Example&period=60&image=https%3A%2F%2Fexample.com%2Flogo.png&lock=true&x-tag=a&x-tag=b"
+	k, err := ImportKey(u)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kt := k.(*Totp)
+	if len(kt.Params) != 3 || kt.Params.Get("image") != "https://example.com/logo.png" || kt.Params.Get("lock") != "true" || len(kt.Params["x-tag"]) != 2 {
+		t.Error("wrong params:", kt.Params)
+		return
+	}
+	// same parameters on export
+	eu, err := url.Parse(k.Url())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ou, _ := url.Parse(u)
+	if q, oq := eu.Query(), ou.Query(); len(q) != len(oq) || q.Encode() != oq.Encode() {
+		t.Error("wrong url:", k.Url())
+		return
+	}
+	// params can't override the key fields
+	kt.Params.Set("secret", "AAAAAAAA")
+	kt.Params.Set("Digits", "8")
+	if eu, err = url.Parse(k.Url()); err != nil {
+		t.Error(err)
+		return
+	} else if q := eu.Query(); q.Get("secret") != "ADS2OR6Q6K3OJZDW" || q.Get("Digits") != "" {
+		t.Error("wrong url:", k.Url())
+		return
+	}
+	// hotp and new keys
+	if k, err = ImportKey("otpauth://hotp/alice?secret=ADS2OR6Q6K3OJZDW&counter=3&image=x"); err != nil {
+		t.Error(err)
+		return
+	} else if kh := k.(*Hotp); len(kh.Params) != 1 || kh.Params.Get("image") != "x" {
+		t.Error("wrong params:", kh.Params)
+		return
+	}
+	if k, err = NewKeyWithDefaults(TypeHotp, "alice", "", url.Values{"counter": {"1"}, "image": {"x"}}); err != nil {
+		t.Error(err)
+		return
+	} else if kh := k.(*Hotp); len(kh.Params) != 1 || kh.Params.Get("image") != "x" {
+		t.Error("wrong params:", kh.Params)
+		return
+	}
+	if k, err = ImportKey("otpauth://totp/alice?secret=ADS2OR6Q6K3OJZDW"); err != nil {
+		t.Error(err)
+		return
+	} else if k.(*Totp).Params != nil {
+		t.Error("params should be nil")
+		return
+	}
+}
+
+func TestRedact(t *testing.T) {
+	const secret = "ADS2OR6Q6K3OJZDW"
+	kt, err := ImportTotp("otpauth://totp/Example:alice?secret=" + secret + "&period=60")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kh, err := ImportHotp("otpauth://hotp/Example:alice?secret=" + secret + "&counter=3")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, k := range []Key{kt, kh} {
+		var buf bytes.Buffer
+		log := slog.New(slog.NewTextHandler(&buf, nil))
+		log.Info("key", "key", k)
+		log.Info("common", "common", *kt.Common)
+		for _, s := range []string{
+			k.String(),
+			fmt.Sprint(k),
+			fmt.Sprintf("%v %+v %#v %s %q %x", k, k, k, k, k, k),
+			fmt.Sprintf("%v %+v %#v", *kt.Common, kt.Common, kt.Common),
+			buf.String(),
+		} {
+			if strings.Contains(s, secret) || strings.Contains(s, string(kt.Key)) || !strings.Contains(s, "alice") {
+				t.Error("leaked the secret:", s)
+				return
+			}
+		}
+		if !strings.Contains(buf.String(), "key.issuer=Example") || !strings.Contains(buf.String(), "key.type="+k.Type()) {
+			t.Error("wrong log:", buf.String())
+			return
+		}
+		// Url is the explicit way to get the secret
+		if !strings.Contains(k.Url(), "secret="+secret) {
+			t.Error("wrong url:", k.Url())
+			return
+		}
+	}
+	if s := kt.String(); s != "otpauth://totp/Example:alice?issuer=Example&period=60&secret=REDACTED" {
+		t.Error("wrong string:", s)
+		return
+	}
+	// parse errors don't include the url
+	if _, err = ImportKey("otpauth://totp/alice%zz?secret=" + secret); !checkError(err, ECUrlParseError) || strings.Contains(err.Error(), secret) {
+		t.Error("got the wrong error:", err)
+		return
+	}
 }
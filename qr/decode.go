@@ -0,0 +1,839 @@
+package qr
+
+import (
+	"errors"
+	"image"
+	_ "image/gif"  // register the gif format
+	_ "image/jpeg" // register the jpeg format
+	_ "image/png"  // register the png format
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/heliorosa/otp"
+)
+
+var (
+	// ErrNotFound is returned when an image doesn't contain any QR code that can be decoded.
+	ErrNotFound = errors.New("qr: no QR code found")
+	// ErrNoKeys is returned when none of the QR codes in an image is an otpauth url.
+	ErrNoKeys = errors.New("qr: no otpauth QR code found")
+)
+
+// ImportKeys reads an image (PNG, JPEG or GIF) from r, decodes the QR codes in it
+// and imports the keys in them, like ImportKeysImage.
+func ImportKeys(r io.Reader) ([]otp.Key, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return ImportKeysImage(img)
+}
+
+// ImportKeysImage decodes the QR codes in img and imports the keys in them.
+// Migration urls may contain several keys. Codes that aren't otpauth urls are skipped.
+// The keys that imported are returned even if others didn't, along with their errors, joined.
+func ImportKeysImage(img image.Image) ([]otp.Key, error) {
+	codes, err := Decode(img)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		keys  []otp.Key
+		errs  []error
+		found bool
+	)
+	for _, c := range codes {
+		u := string(c)
+		switch scheme, _, _ := strings.Cut(u, ":"); strings.ToLower(scheme) {
+		case "otpauth-migration":
+			found = true
+			ks, _, err := otp.ImportMigration(u)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			keys = append(keys, ks...)
+		case "otpauth":
+			found = true
+			k, err := otp.ImportKey(u)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			keys = append(keys, k)
+		}
+	}
+	if !found {
+		return nil, ErrNoKeys
+	}
+	return keys, errors.Join(errs...)
+}
+
+// Decode finds and decodes the QR codes in img, returning their contents.
+func Decode(img image.Image) ([][]byte, error) {
+	bm := binarize(img)
+	fps := bm.findFinders()
+	// try the most plausible groups of finder patterns first
+	var (
+		used = make([]bool, len(fps))
+		r    [][]byte
+	)
+	for _, g := range groupFinders(fps) {
+		if used[g.tl] || used[g.tr] || used[g.bl] {
+			continue
+		}
+		if data, err := bm.decodeGroup(fps[g.tl], fps[g.tr], fps[g.bl]); err == nil {
+			used[g.tl], used[g.tr], used[g.bl] = true, true, true
+			r = append(r, data)
+		}
+	}
+	if len(r) == 0 {
+		return nil, ErrNotFound
+	}
+	return r, nil
+}
+
+// binary image, true is dark
+type bitmap struct {
+	w, h int
+	px   []bool
+}
+
+// dark pixel? outside of the image is light
+func (b *bitmap) at(x, y int) bool { return x >= 0 && y >= 0 && x < b.w && y < b.h && b.px[y*b.w+x] }
+
+// binarize img with a threshold from the mean of the surrounding pixels
+func binarize(img image.Image) *bitmap {
+	rc := img.Bounds()
+	w, h := rc.Dx(), rc.Dy()
+	// luminance and its integral image
+	lum := make([]int, w*h)
+	sum := make([]int, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		row := 0
+		for x := 0; x < w; x++ {
+			r, g, b, a := img.At(rc.Min.X+x, rc.Min.Y+y).RGBA()
+			// transparent pixels are light
+			l := int((299*r+587*g+114*b)/1000>>8) + int(255-a>>8)
+			if l > 255 {
+				l = 255
+			}
+			lum[y*w+x] = l
+			row += l
+			sum[(y+1)*(w+1)+x+1] = sum[y*(w+1)+x+1] + row
+		}
+	}
+	// the window must be wider than the center of the finder patterns
+	rad := max(8, min(w, h)/8)
+	bm := &bitmap{w: w, h: h, px: make([]bool, w*h)}
+	for y := 0; y < h; y++ {
+		y0, y1 := max(0, y-rad), min(h, y+rad+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(0, x-rad), min(w, x+rad+1)
+			s := sum[y1*(w+1)+x1] - sum[y0*(w+1)+x1] - sum[y1*(w+1)+x0] + sum[y0*(w+1)+x0]
+			mean := s / ((y1 - y0) * (x1 - x0))
+			bm.px[y*w+x] = lum[y*w+x]+8 < mean
+		}
+	}
+	return bm
+}
+
+// finder pattern candidate
+type finder struct {
+	x, y float64
+	// module size
+	ms float64
+	// number of times it was found
+	n int
+}
+
+// check the 1:1:3:1:1 ratio of the runs
+func finderRatio(runs []int) bool {
+	total := 0
+	for _, r := range runs {
+		if r == 0 {
+			return false
+		}
+		total += r
+	}
+	if total < 7 {
+		return false
+	}
+	ms := float64(total) / 7
+	v := ms / 2
+	return math.Abs(ms-float64(runs[0])) < v && math.Abs(ms-float64(runs[1])) < v &&
+		math.Abs(3*ms-float64(runs[2])) < 3*v &&
+		math.Abs(ms-float64(runs[3])) < v && math.Abs(ms-float64(runs[4])) < v
+}
+
+// count the runs of a finder pattern along the line through x, y with direction dx, dy.
+// It returns the runs and the position, along the line, of the center.
+func (b *bitmap) crossCheck(x, y, dx, dy int, maxRun int) ([]int, float64, bool) {
+	if !b.at(x, y) {
+		return nil, 0, false
+	}
+	runs := make([]int, 5)
+	// backwards: center, light, dark
+	i := 0
+	for b.at(x-i*dx, y-i*dy) {
+		runs[2]++
+		i++
+	}
+	for st := 1; st >= 0; st-- {
+		dark := st == 0
+		for b.at(x-i*dx, y-i*dy) == dark && runs[st] <= maxRun {
+			if x-i*dx < 0 || y-i*dy < 0 {
+				break
+			}
+			runs[st]++
+			i++
+		}
+	}
+	back := i
+	// forwards
+	i = 1
+	for b.at(x+i*dx, y+i*dy) {
+		runs[2]++
+		i++
+	}
+	for st := 3; st <= 4; st++ {
+		dark := st == 4
+		for b.at(x+i*dx, y+i*dy) == dark && runs[st] <= maxRun {
+			if x+i*dx >= b.w || y+i*dy >= b.h {
+				break
+			}
+			runs[st]++
+			i++
+		}
+	}
+	if !finderRatio(runs) {
+		return nil, 0, false
+	}
+	// center of the middle run, relative to x, y
+	start := 1 - (back - runs[0] - runs[1])
+	return runs, float64(start) + float64(runs[2])/2, true
+}
+
+// find the finder patterns, scanning the rows and checking the columns
+func (b *bitmap) findFinders() []finder {
+	var fps []finder
+	for y := 0; y < b.h; y++ {
+		// run length encode the row, starting with a dark run
+		var (
+			runs   []int
+			starts []int
+		)
+		for x := 0; x < b.w; {
+			s := x
+			d := b.at(x, y)
+			for x < b.w && b.at(x, y) == d {
+				x++
+			}
+			if len(runs) == 0 && !d {
+				continue
+			}
+			runs = append(runs, x-s)
+			starts = append(starts, s)
+		}
+		for i := 0; i+5 <= len(runs); i += 2 {
+			if !finderRatio(runs[i : i+5]) {
+				continue
+			}
+			total := 0
+			for _, r := range runs[i : i+5] {
+				total += r
+			}
+			cx := int(float64(starts[i+2]) + float64(runs[i+2])/2)
+			// vertical check
+			vr, cy, ok := b.crossCheck(cx, y, 0, 1, total)
+			if !ok {
+				continue
+			}
+			vt := vr[0] + vr[1] + vr[2] + vr[3] + vr[4]
+			if 5*abs(vt-total) >= 2*total {
+				continue
+			}
+			fy := float64(y) + cy
+			// horizontal check again, through the vertical center
+			hr, cx2, ok := b.crossCheck(cx, int(fy), 1, 0, total)
+			if !ok {
+				continue
+			}
+			ht := hr[0] + hr[1] + hr[2] + hr[3] + hr[4]
+			fx := float64(cx) + cx2
+			ms := float64(vt+ht) / 14
+			fps = addFinder(fps, finder{fx, fy, ms, 1})
+		}
+	}
+	// finders found on a single row are likely noise
+	r := fps[:0]
+	for _, f := range fps {
+		if f.n >= 2 || f.ms < 2 {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+// add a finder candidate, merging it with an existing one if it's close
+func addFinder(fps []finder, f finder) []finder {
+	for i, c := range fps {
+		if math.Abs(c.x-f.x) <= c.ms*1.5 && math.Abs(c.y-f.y) <= c.ms*1.5 && math.Abs(c.ms-f.ms) <= math.Max(1, c.ms/2) {
+			n := float64(c.n)
+			fps[i] = finder{(c.x*n + f.x) / (n + 1), (c.y*n + f.y) / (n + 1), (c.ms*n + f.ms) / (n + 1), c.n + 1}
+			return fps
+		}
+	}
+	return append(fps, f)
+}
+
+// group of three finders: top left, top right and bottom left
+type finderGroup struct {
+	tl, tr, bl int
+	score      float64
+}
+
+// find the groups of finders that can be QR codes, the best first
+func groupFinders(fps []finder) []finderGroup {
+	// keep the most seen candidates
+	idx := make([]int, len(fps))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return fps[idx[i]].n > fps[idx[j]].n })
+	if len(idx) > 30 {
+		idx = idx[:30]
+	}
+	dist := func(a, b finder) float64 { return math.Hypot(a.x-b.x, a.y-b.y) }
+	var gs []finderGroup
+	for i := 0; i < len(idx); i++ {
+		for j := i + 1; j < len(idx); j++ {
+			for k := j + 1; k < len(idx); k++ {
+				g := []int{idx[i], idx[j], idx[k]}
+				a, b, c := fps[g[0]], fps[g[1]], fps[g[2]]
+				// similar module sizes
+				mmin, mmax := math.Min(a.ms, math.Min(b.ms, c.ms)), math.Max(a.ms, math.Max(b.ms, c.ms))
+				if mmax > mmin*1.5 {
+					continue
+				}
+				// the top left finder is opposite to the longest side
+				dab, dbc, dac := dist(a, b), dist(b, c), dist(a, c)
+				tl, p, q, hyp := g[0], g[1], g[2], dbc
+				if dab >= dbc && dab >= dac {
+					tl, p, q, hyp = g[2], g[0], g[1], dab
+				} else if dac >= dbc && dac >= dab {
+					tl, p, q, hyp = g[1], g[0], g[2], dac
+				}
+				l1, l2 := dist(fps[tl], fps[p]), dist(fps[tl], fps[q])
+				// isosceles right triangle
+				if math.Abs(l1-l2) > 0.2*math.Max(l1, l2) || math.Abs(hyp-math.Sqrt2*(l1+l2)/2) > 0.15*hyp {
+					continue
+				}
+				// 21 to 177 modules
+				if mods := (l1 + l2) / 2 / ((a.ms + b.ms + c.ms) / 3); mods < 8 || mods > 180 {
+					continue
+				}
+				// clockwise: top left, top right, bottom left
+				t, pp, qq := fps[tl], fps[p], fps[q]
+				if (pp.x-t.x)*(qq.y-t.y)-(pp.y-t.y)*(qq.x-t.x) < 0 {
+					p, q = q, p
+				}
+				score := math.Abs(l1-l2)/math.Max(l1, l2) + math.Abs(hyp-math.Sqrt2*(l1+l2)/2)/hyp + (mmax-mmin)/mmax
+				gs = append(gs, finderGroup{tl, p, q, score})
+			}
+		}
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].score < gs[j].score })
+	return gs
+}
+
+// projective transform from module to image coordinates
+type transform [9]float64
+
+// map the module coordinates x, y to image coordinates
+func (t *transform) apply(x, y float64) (float64, float64) {
+	d := t[6]*x + t[7]*y + t[8]
+	return (t[0]*x + t[1]*y + t[2]) / d, (t[3]*x + t[4]*y + t[5]) / d
+}
+
+// projective transform mapping the points src to dst, at least 4, with least squares
+func newTransform(src, dst [][2]float64) (*transform, bool) {
+	// normal equations of the linear system, solved with gaussian elimination
+	var a [8][9]float64
+	for i := range src {
+		x, y, u, v := src[i][0], src[i][1], dst[i][0], dst[i][1]
+		for _, row := range [][9]float64{
+			{x, y, 1, 0, 0, 0, -u * x, -u * y, u},
+			{0, 0, 0, x, y, 1, -v * x, -v * y, v},
+		} {
+			for j := 0; j < 8; j++ {
+				for k := 0; k < 9; k++ {
+					a[j][k] += row[j] * row[k]
+				}
+			}
+		}
+	}
+	for c := 0; c < 8; c++ {
+		p := c
+		for r := c + 1; r < 8; r++ {
+			if math.Abs(a[r][c]) > math.Abs(a[p][c]) {
+				p = r
+			}
+		}
+		if math.Abs(a[p][c]) < 1e-9 {
+			return nil, false
+		}
+		a[c], a[p] = a[p], a[c]
+		for r := 0; r < 8; r++ {
+			if r == c {
+				continue
+			}
+			f := a[r][c] / a[c][c]
+			for k := c; k < 9; k++ {
+				a[r][k] -= f * a[c][k]
+			}
+		}
+	}
+	t := &transform{}
+	for i := 0; i < 8; i++ {
+		t[i] = a[i][8] / a[i][i]
+	}
+	t[8] = 1
+	return t, true
+}
+
+// decode the code with the finders tl, tr and bl
+func (b *bitmap) decodeGroup(tl, tr, bl finder) ([]byte, error) {
+	// the module size of the candidates is skewed by rotation, measure it along the sides
+	mods := (math.Hypot(tr.x-tl.x, tr.y-tl.y)/b.moduleSize(tl, tr) + math.Hypot(bl.x-tl.x, bl.y-tl.y)/b.moduleSize(tl, bl)) / 2
+	if math.IsNaN(mods) || math.IsInf(mods, 0) {
+		return nil, ErrNotFound
+	}
+	ver := min(max(int(math.Round((mods+7-17)/4)), 1), 40)
+	vers := []int{ver, ver - 1, ver + 1}
+	// bigger codes have the version information
+	if ver >= 7 {
+		if t, ok := b.finderTransform(tl, tr, bl, ver); ok {
+			if v, ok := b.sample(t, ver*4+17).readVersion(); ok {
+				vers = []int{v}
+			}
+		}
+	}
+	var lastErr error = ErrNotFound
+	for _, v := range vers {
+		if v < 1 || v > 40 {
+			continue
+		}
+		data, err := b.decodeVersion(tl, tr, bl, v)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// module size along the line between the finders a and b, from the width of both patterns
+func (b *bitmap) moduleSize(f1, f2 finder) float64 {
+	d := math.Hypot(f2.x-f1.x, f2.y-f1.y)
+	dx, dy := (f2.x-f1.x)/d, (f2.y-f1.y)/d
+	// distance from the center to the outer edge, 3.5 modules
+	edge := func(f finder, dx, dy float64) float64 {
+		dark, n := true, 0
+		for t := 0.0; t < 10*f.ms; t++ {
+			if b.at(int(math.Floor(f.x+t*dx)), int(math.Floor(f.y+t*dy))) != dark {
+				dark = !dark
+				if n++; n == 3 {
+					return t
+				}
+			}
+		}
+		return math.NaN()
+	}
+	return (edge(f1, dx, dy) + edge(f1, -dx, -dy) + edge(f2, dx, dy) + edge(f2, -dx, -dy)) / 14
+}
+
+// transform from the centers of the finders, the bottom right corner completes the parallelogram
+func (b *bitmap) finderTransform(tl, tr, bl finder, ver int) (*transform, bool) {
+	s := float64(ver*4 + 17)
+	return newTransform(
+		[][2]float64{{3.5, 3.5}, {s - 3.5, 3.5}, {s - 3.5, s - 3.5}, {3.5, s - 3.5}},
+		[][2]float64{{tl.x, tl.y}, {tr.x, tr.y}, {tr.x + bl.x - tl.x, tr.y + bl.y - tl.y}, {bl.x, bl.y}},
+	)
+}
+
+// sample and decode the code assuming version ver
+func (b *bitmap) decodeVersion(tl, tr, bl finder, ver int) ([]byte, error) {
+	size := ver*4 + 17
+	t, ok := b.finderTransform(tl, tr, bl, ver)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	ts := []*transform{t}
+	if ver >= 2 {
+		// the bottom right alignment pattern corrects the perspective
+		s := float64(size)
+		src := [][2]float64{{3.5, 3.5}, {s - 3.5, 3.5}, {3.5, s - 3.5}}
+		dst := [][2]float64{{tl.x, tl.y}, {tr.x, tr.y}, {bl.x, bl.y}}
+		if px, py, ok := b.findAlignment(t, s-6.5, s-6.5, 4); ok {
+			if pt, ok := newTransform(append(src, [2]float64{s - 6.5, s - 6.5}), append(dst, [2]float64{px, py})); ok {
+				ts = append([]*transform{pt}, ts...)
+				// and all the others fix the distortion of bigger codes
+				if ver >= 7 {
+					ap := alignmentPositions(ver)
+					for i, x := range ap {
+						for j, y := range ap {
+							if i == 0 && j == 0 || i == 0 && j == len(ap)-1 || i == len(ap)-1 && j == 0 {
+								continue
+							}
+							ax, ay := float64(x)+0.5, float64(y)+0.5
+							if px, py, ok := b.findAlignment(pt, ax, ay, 2); ok {
+								src = append(src, [2]float64{ax, ay})
+								dst = append(dst, [2]float64{px, py})
+							}
+						}
+					}
+					if len(src) >= 4 {
+						if at, ok := newTransform(src, dst); ok {
+							ts = append([]*transform{at}, ts...)
+						}
+					}
+				}
+			}
+		}
+	}
+	var lastErr error
+	for _, t := range ts {
+		data, err := b.sample(t, size).decode()
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// look for the alignment pattern within r modules of the module coordinates x, y
+func (b *bitmap) findAlignment(t *transform, x, y, r float64) (float64, float64, bool) {
+	cx, cy := t.apply(x, y)
+	ux, uy := t.apply(x+1, y)
+	vx, vy := t.apply(x, y+1)
+	ux, uy, vx, vy = ux-cx, uy-cy, vx-cx, vy-cy
+	ms := math.Max(math.Hypot(ux, uy), math.Hypot(vx, vy))
+	rp := int(math.Ceil(ms * r))
+	var best [][2]float64
+	for dy := -rp; dy <= rp; dy++ {
+		for dx := -rp; dx <= rp; dx++ {
+			px, py := cx+float64(dx), cy+float64(dy)
+			// dark center, light ring, dark ring
+			match := true
+			for j := -2; j <= 2 && match; j++ {
+				for i := -2; i <= 2 && match; i++ {
+					want := max(abs(i), abs(j)) != 1
+					match = b.at(int(math.Floor(px+float64(i)*ux+float64(j)*vx)), int(math.Floor(py+float64(i)*uy+float64(j)*vy))) == want
+				}
+			}
+			if match {
+				best = append(best, [2]float64{px, py})
+			}
+		}
+	}
+	if len(best) == 0 {
+		return 0, 0, false
+	}
+	// the center of the matches closest to the estimate
+	c := best[0]
+	for _, p := range best {
+		if math.Hypot(p[0]-cx, p[1]-cy) < math.Hypot(c[0]-cx, c[1]-cy) {
+			c = p
+		}
+	}
+	var sx, sy, n float64
+	for _, p := range best {
+		if math.Hypot(p[0]-c[0], p[1]-c[1]) <= ms {
+			sx, sy, n = sx+p[0], sy+p[1], n+1
+		}
+	}
+	return sx / n, sy / n, true
+}
+
+// sample the modules of a code of size modules
+func (b *bitmap) sample(t *transform, size int) *Code {
+	c := &Code{Size: size, modules: make([]bool, size*size)}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			px, py := t.apply(float64(x)+0.5, float64(y)+0.5)
+			c.modules[y*size+x] = b.at(int(math.Floor(px)), int(math.Floor(py)))
+		}
+	}
+	return c
+}
+
+// number of bits that differ
+func hamming(a, b int) int {
+	n := 0
+	for d := a ^ b; d != 0; d &= d - 1 {
+		n++
+	}
+	return n
+}
+
+// read the format information, either copy
+func (c *Code) readFormat() (Level, int, bool) {
+	bit := func(x, y int) int {
+		if c.Black(x, y) {
+			return 1
+		}
+		return 0
+	}
+	var f1, f2 int
+	for i := 0; i <= 5; i++ {
+		f1 |= bit(8, i) << i
+	}
+	f1 |= bit(8, 7)<<6 | bit(8, 8)<<7 | bit(7, 8)<<8
+	for i := 9; i < 15; i++ {
+		f1 |= bit(14-i, 8) << i
+	}
+	for i := 0; i < 8; i++ {
+		f2 |= bit(c.Size-1-i, 8) << i
+	}
+	for i := 8; i < 15; i++ {
+		f2 |= bit(8, c.Size-15+i) << i
+	}
+	best, bl, bm := 4, L, 0
+	for l := L; l <= H; l++ {
+		for m := range masks {
+			fb := formatBits(l, m)
+			for _, f := range []int{f1, f2} {
+				if d := hamming(f, fb); d < best {
+					best, bl, bm = d, l, m
+				}
+			}
+		}
+	}
+	return bl, bm, best <= 3
+}
+
+// read the version information, either copy
+func (c *Code) readVersion() (int, bool) {
+	var v1, v2 int
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		if c.Black(a, b) {
+			v1 |= 1 << i
+		}
+		if c.Black(b, a) {
+			v2 |= 1 << i
+		}
+	}
+	best, bv := 4, 0
+	for v := 7; v <= 40; v++ {
+		vb := versionBits(v)
+		for _, x := range []int{v1, v2} {
+			if d := hamming(x, vb); d < best {
+				best, bv = d, v
+			}
+		}
+	}
+	return bv, best <= 3
+}
+
+// decode the sampled modules
+func (c *Code) decode() ([]byte, error) {
+	c.Version = (c.Size - 17) / 4
+	if c.Version >= 7 {
+		if v, ok := c.readVersion(); !ok || v != c.Version {
+			return nil, ErrNotFound
+		}
+	}
+	var ok bool
+	if c.Level, c.Mask, ok = c.readFormat(); !ok {
+		return nil, ErrNotFound
+	}
+	// function modules of a clean code of the same version
+	fc := &Code{Version: c.Version, Level: c.Level, Size: c.Size}
+	fc.modules = make([]bool, c.Size*c.Size)
+	fc.function = make([]bool, c.Size*c.Size)
+	fc.drawFunction()
+	c.function = fc.function
+	// read the codewords in the zigzag order, unmasked
+	c.applyMask(c.Mask)
+	raw := make([]byte, rawModules(c.Version)/8)
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for v := 0; v < c.Size; v++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, v
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - v
+				}
+				if !c.function[y*c.Size+x] && i < len(raw)*8 {
+					if c.modules[y*c.Size+x] {
+						raw[i>>3] |= 0x80 >> (i & 7)
+					}
+					i++
+				}
+			}
+		}
+	}
+	c.applyMask(c.Mask)
+	data, err := c.deinterleave(raw)
+	if err != nil {
+		return nil, err
+	}
+	return parseSegments(data, c.Version)
+}
+
+// split the codewords in blocks, correct the errors and join the data
+func (c *Code) deinterleave(raw []byte) ([]byte, error) {
+	var (
+		nb       = eccBlocks[c.Level][c.Version]
+		eccLen   = eccPerBlock[c.Level][c.Version]
+		nShort   = nb - len(raw)%nb
+		shortLen = len(raw) / nb
+		blocks   = make([][]byte, nb)
+	)
+	for j := range blocks {
+		blocks[j] = make([]byte, shortLen+1)
+	}
+	// inverse of interleave, short blocks have a placeholder
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for j := range blocks {
+			if i != shortLen-eccLen || j >= nShort {
+				blocks[j][i] = raw[k]
+				k++
+			}
+		}
+	}
+	var data []byte
+	for j, b := range blocks {
+		if j < nShort {
+			b = append(b[:shortLen-eccLen], b[shortLen-eccLen+1:]...)
+		}
+		if _, err := rsCorrect(b, eccLen); err != nil {
+			return nil, err
+		}
+		data = append(data, b[:len(b)-eccLen]...)
+	}
+	return data, nil
+}
+
+// bit reader
+type bitReader struct {
+	b []byte
+	n int
+}
+
+// read n bits, -1 if there aren't enough
+func (br *bitReader) read(n int) int {
+	if br.n+n > len(br.b)*8 {
+		return -1
+	}
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | int(br.b[br.n>>3]>>(7-br.n&7)&1)
+		br.n++
+	}
+	return v
+}
+
+// characters of the alphanumeric mode
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// errFormat is returned when the data segments can't be parsed.
+var errFormat = errors.New("qr: invalid data")
+
+// parse the data segments
+func parseSegments(data []byte, ver int) ([]byte, error) {
+	br := &bitReader{b: data}
+	// character count bits for the numeric, alphanumeric and byte modes
+	cb := [3]int{10, 9, 8}
+	if ver >= 27 {
+		cb = [3]int{14, 13, 16}
+	} else if ver >= 10 {
+		cb = [3]int{12, 11, 16}
+	}
+	var r []byte
+	for {
+		mode := br.read(4)
+		switch mode {
+		case -1, 0:
+			// terminator or end of data
+			return r, nil
+		case 1:
+			// numeric
+			n := br.read(cb[0])
+			for ; n >= 3; n -= 3 {
+				v := br.read(10)
+				if v < 0 || v > 999 {
+					return nil, errFormat
+				}
+				r = append(r, byte('0'+v/100), byte('0'+v/10%10), byte('0'+v%10))
+			}
+			if n == 2 {
+				v := br.read(7)
+				if v < 0 || v > 99 {
+					return nil, errFormat
+				}
+				r = append(r, byte('0'+v/10), byte('0'+v%10))
+			} else if n == 1 {
+				v := br.read(4)
+				if v < 0 || v > 9 {
+					return nil, errFormat
+				}
+				r = append(r, byte('0'+v))
+			}
+		case 2:
+			// alphanumeric
+			n := br.read(cb[1])
+			for ; n >= 2; n -= 2 {
+				v := br.read(11)
+				if v < 0 || v >= 45*45 {
+					return nil, errFormat
+				}
+				r = append(r, alphanumeric[v/45], alphanumeric[v%45])
+			}
+			if n == 1 {
+				v := br.read(6)
+				if v < 0 || v >= 45 {
+					return nil, errFormat
+				}
+				r = append(r, alphanumeric[v])
+			}
+		case 4:
+			// byte
+			n := br.read(cb[2])
+			for i := 0; i < n; i++ {
+				v := br.read(8)
+				if v < 0 {
+					return nil, errFormat
+				}
+				r = append(r, byte(v))
+			}
+		case 7:
+			// ECI, the designator is ignored
+			v := br.read(8)
+			if v>>6 == 2 {
+				br.read(8)
+			} else if v>>5 == 6 {
+				br.read(16)
+			}
+		case 3:
+			// structured append
+			br.read(16)
+		case 5:
+			// FNC1, first position
+		case 9:
+			// FNC1, second position
+			br.read(8)
+		default:
+			return nil, errFormat
+		}
+	}
+}
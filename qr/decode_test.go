@@ -0,0 +1,231 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/heliorosa/otp"
+)
+
+func TestRSCorrect(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		n := 2 + r.Intn(30)
+		data := make([]byte, 1+r.Intn(100))
+		r.Read(data)
+		b := append(append([]byte{}, data...), rsEncode(data, n)...)
+		orig := append([]byte{}, b...)
+		// up to n/2 errors can be corrected
+		ne := min(r.Intn(n/2+1), len(b))
+		for _, p := range r.Perm(len(b))[:ne] {
+			b[p] ^= byte(1 + r.Intn(255))
+		}
+		if c, err := rsCorrect(b, n); err != nil {
+			t.Error(err)
+			return
+		} else if c != ne || !bytes.Equal(b, orig) {
+			t.Error("wrong correction, errors:", ne, "corrected:", c)
+			return
+		}
+	}
+}
+
+// transform img with the inverse mapping f, from destination to source coordinates
+func warp(img image.Image, w, h int, f func(x, y float64) (float64, float64)) *image.Gray {
+	r := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := f(float64(x)+0.5, float64(y)+0.5)
+			p := image.Pt(int(math.Floor(sx)), int(math.Floor(sy)))
+			if p.In(img.Bounds()) {
+				r.Set(x, y, img.At(p.X, p.Y))
+			} else {
+				r.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	return r
+}
+
+func rotate(img image.Image, deg float64) *image.Gray {
+	a := deg * math.Pi / 180
+	sin, cos := math.Sin(a), math.Cos(a)
+	b := img.Bounds()
+	n := int(float64(b.Dx()) * (math.Abs(sin) + math.Abs(cos)))
+	c, sc := float64(n)/2, float64(b.Dx())/2
+	return warp(img, n, n, func(x, y float64) (float64, float64) {
+		x, y = x-c, y-c
+		return cos*x + sin*y + sc, -sin*x + cos*y + sc
+	})
+}
+
+func TestDecode(t *testing.T) {
+	const u = "otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW"
+	c, err := Encode([]byte(u), M)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	img := c.Image(4, -1)
+	n := img.Bounds().Dx()
+	// bigger code, with version information
+	big, err := Encode(bytes.Repeat([]byte("0123456789"), 20), Q)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for name, tc := range map[string]image.Image{
+		"plain":   img,
+		"version": big.Image(3, -1),
+		"scaled": warp(img, n*7/3, n*7/3, func(x, y float64) (float64, float64) {
+			return x * 3 / 7, y * 3 / 7
+		}),
+		"rot90": rotate(img, 90),
+		"rot15": rotate(c.Image(6, -1), 15),
+		"perspective": warp(img, n, n, func(x, y float64) (float64, float64) {
+			d := 1 + 0.0004*x
+			return x / d, (y - 0.0002*x*float64(n)) / d
+		}),
+	} {
+		codes, err := Decode(tc)
+		if err != nil {
+			t.Error(name, err)
+			return
+		}
+		want := u
+		if name == "version" {
+			want = string(bytes.Repeat([]byte("0123456789"), 20))
+		}
+		if len(codes) != 1 || string(codes[0]) != want {
+			t.Errorf("%s: wrong content: %q", name, codes)
+			return
+		}
+	}
+	// errors are corrected
+	for i := 0; i < 20; i++ {
+		c.modules[(c.Size-8)*c.Size+10+i] = !c.modules[(c.Size-8)*c.Size+10+i]
+	}
+	if codes, err := Decode(c.Image(4, -1)); err != nil {
+		t.Error(err)
+		return
+	} else if len(codes) != 1 || string(codes[0]) != u {
+		t.Errorf("wrong content: %q", codes)
+		return
+	}
+	if _, err = Decode(image.NewGray(image.Rect(0, 0, 100, 100))); err != ErrNotFound {
+		t.Error("got the wrong error:", err)
+		return
+	}
+}
+
+func TestImportKeys(t *testing.T) {
+	k1, err := otp.ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	k2, err := otp.ImportHotp("otpauth://hotp/other.org?secret=GEZDGNBVGY3TQOJQ&counter=7")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// two codes side by side
+	var imgs []image.Image
+	for _, k := range []otp.Key{k1, k2} {
+		c, err := EncodeKey(k, DefaultLevel)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		imgs = append(imgs, c.Image(4, -1))
+	}
+	var buf bytes.Buffer
+	if err = jpeg.Encode(&buf, sideBySide(imgs...), &jpeg.Options{Quality: 75}); err != nil {
+		t.Error(err)
+		return
+	}
+	keys, err := ImportKeys(&buf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(keys) != 2 {
+		t.Error("expected 2 keys, got:", len(keys))
+		return
+	}
+	urls := map[string]bool{keys[0].Url(): true, keys[1].Url(): true}
+	if !urls[k1.Url()] || !urls[k2.Url()] {
+		t.Error("wrong keys:", keys[0].Url(), keys[1].Url())
+		return
+	}
+	// migration urls
+	mu, err := otp.ExportMigration([]otp.Key{k1, k2}, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	c, err := Encode([]byte(mu[0]), L)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	buf.Reset()
+	if err = png.Encode(&buf, c.Image(2, -1)); err != nil {
+		t.Error(err)
+		return
+	}
+	if keys, err = ImportKeys(&buf); err != nil {
+		t.Error(err)
+		return
+	} else if len(keys) != 2 || keys[1].Url() != k2.Url() {
+		t.Error("wrong keys:", keys)
+		return
+	}
+	// unrelated codes are skipped, invalid keys are reported
+	imgs = imgs[:0]
+	for _, s := range []string{"https://example.com/support", k1.Url(), "otpauth://totp/bad?secret=A!S2OR6Q6K3OJZDW"} {
+		c, err := Encode([]byte(s), DefaultLevel)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		imgs = append(imgs, c.Image(4, -1))
+	}
+	keys, err = ImportKeysImage(sideBySide(imgs...))
+	if !errors.Is(err, otp.ErrBase32Decoding) {
+		t.Error("expected a base32 error, got:", err)
+		return
+	}
+	if len(keys) != 1 || keys[0].Url() != k1.Url() {
+		t.Error("wrong keys:", keys)
+		return
+	}
+	if _, err = ImportKeysImage(imgs[0]); err != ErrNoKeys {
+		t.Error("expected ErrNoKeys, got:", err)
+		return
+	}
+}
+
+// draw the images in a row, on a white background
+func sideBySide(imgs ...image.Image) image.Image {
+	w, h := 0, 0
+	for _, img := range imgs {
+		w, h = w+img.Bounds().Dx(), max(h, img.Bounds().Dy())
+	}
+	r := image.NewGray(image.Rect(0, 0, w, h))
+	draw.Draw(r, r.Bounds(), image.White, image.Point{}, draw.Src)
+	x := 0
+	for _, img := range imgs {
+		draw.Draw(r, img.Bounds().Sub(img.Bounds().Min).Add(image.Pt(x, 0)), img, img.Bounds().Min, draw.Src)
+		x += img.Bounds().Dx()
+	}
+	return r
+}
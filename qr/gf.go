@@ -0,0 +1,76 @@
+package qr
+
+// GF(256) arithmetic with the QR code polynomial x^8 + x^4 + x^3 + x^2 + 1.
+var (
+	gfExp [512]byte
+	gfLog [256]int
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	// avoid the modulo in gfMul
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+// multiply a and b
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+// divide a by b, b != 0
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+255-gfLog[b]]
+}
+
+// 2^e
+func gfPow2(e int) byte { return gfExp[((e%255)+255)%255] }
+
+// rsGenerator returns the coefficients, highest power first and without the
+// leading 1, of the Reed-Solomon generator polynomial of degree n.
+func rsGenerator(n int) []byte {
+	g := make([]byte, n)
+	g[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		// multiply by (x - root)
+		for j := 0; j < n; j++ {
+			g[j] = gfMul(g[j], root)
+			if j+1 < n {
+				g[j] ^= g[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return g
+}
+
+// rsEncode returns the n error correction codewords for data.
+func rsEncode(data []byte, n int) []byte {
+	g := rsGenerator(n)
+	r := make([]byte, n)
+	for _, b := range data {
+		f := b ^ r[0]
+		copy(r, r[1:])
+		r[n-1] = 0
+		for i := range r {
+			r[i] ^= gfMul(g[i], f)
+		}
+	}
+	return r
+}
@@ -0,0 +1,461 @@
+/*
+Package qr encodes and decodes the QR codes used to enroll OTP keys.
+
+Encoding only uses the byte mode, which is all that's needed for otpauth urls.
+Decoding finds every code in an image, upright or rotated, and reads all the modes
+but kanji.
+*/
+package qr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/heliorosa/otp"
+)
+
+// Level is the error correction level.
+type Level int
+
+// Error correction levels.
+const (
+	L Level = iota // Recovers 7% of the data.
+	M              // Recovers 15% of the data.
+	Q              // Recovers 25% of the data.
+	H              // Recovers 30% of the data.
+)
+
+// Defaults.
+const (
+	DefaultLevel = M // Error correction level used for keys.
+	QuietZone    = 4 // Width of the quiet zone required by the standard, in modules.
+)
+
+// Errors.
+var (
+	ErrTooLong      = errors.New("qr: data too long")
+	ErrInvalidLevel = errors.New("qr: invalid error correction level")
+)
+
+func (l Level) String() string {
+	switch l {
+	case L:
+		return "L"
+	case M:
+		return "M"
+	case Q:
+		return "Q"
+	case H:
+		return "H"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// level bits in the format information
+var formatLevel = [4]int{L: 1, M: 0, Q: 3, H: 2}
+
+// error correction codewords per block, by level and version
+var eccPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// number of error correction blocks, by level and version
+var eccBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// number of modules available for data and error correction
+func rawModules(ver int) int {
+	r := (16*ver+128)*ver + 64
+	if ver >= 2 {
+		na := ver/7 + 2
+		r -= (25*na-10)*na - 55
+		if ver >= 7 {
+			r -= 36
+		}
+	}
+	return r
+}
+
+// number of data codewords
+func dataCodewords(ver int, l Level) int {
+	return rawModules(ver)/8 - eccPerBlock[l][ver]*eccBlocks[l][ver]
+}
+
+// bits of the character count in byte mode
+func countBits(ver int) int {
+	if ver <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// positions of the alignment patterns
+func alignmentPositions(ver int) []int {
+	if ver == 1 {
+		return nil
+	}
+	na := ver/7 + 2
+	step := (ver*8 + na*3 + 5) / (na*4 - 4) * 2
+	r := make([]int, na)
+	r[0] = 6
+	for i, pos := na-1, ver*4+17-7; i > 0; i, pos = i-1, pos-step {
+		r[i] = pos
+	}
+	return r
+}
+
+// format information bits: level, mask and BCH code
+func formatBits(l Level, mask int) int {
+	d := formatLevel[l]<<3 | mask
+	r := d
+	for i := 0; i < 10; i++ {
+		r = r<<1 ^ (r>>9)*0x537
+	}
+	return (d<<10 | r) ^ 0x5412
+}
+
+// version information bits: version and BCH code
+func versionBits(ver int) int {
+	r := ver
+	for i := 0; i < 12; i++ {
+		r = r<<1 ^ (r>>11)*0x1f25
+	}
+	return ver<<12 | r
+}
+
+// mask functions
+var masks = [8]func(x, y int) bool{
+	func(x, y int) bool { return (x+y)%2 == 0 },
+	func(x, y int) bool { return y%2 == 0 },
+	func(x, y int) bool { return x%3 == 0 },
+	func(x, y int) bool { return (x+y)%3 == 0 },
+	func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+	func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+	func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+	func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+}
+
+// Code is a QR code.
+type Code struct {
+	// Version. 1 to 40.
+	Version int
+	// Error correction level.
+	Level Level
+	// Mask. 0 to 7.
+	Mask int
+	// Size in modules.
+	Size int
+
+	// dark modules, row by row
+	modules []bool
+	// function modules, not used for data
+	function []bool
+}
+
+// Black reports whether the module at x, y is dark.
+// Modules outside of the code are light.
+func (c *Code) Black(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y*c.Size+x]
+}
+
+// set a function module
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y*c.Size+x] = dark
+	c.function[y*c.Size+x] = true
+}
+
+// Encode encodes data in a QR code with the error correction level l,
+// using the smallest version that fits.
+func Encode(data []byte, l Level) (*Code, error) {
+	if l < L || l > H {
+		return nil, ErrInvalidLevel
+	}
+	// find the version
+	ver := 1
+	for ; ver <= 40; ver++ {
+		if 4+countBits(ver)+8*len(data) <= dataCodewords(ver, l)*8 {
+			break
+		}
+	}
+	if ver > 40 {
+		return nil, ErrTooLong
+	}
+	// mode, count and data
+	var bb bitBuffer
+	bb.append(4, 4)
+	bb.append(len(data), countBits(ver))
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+	// terminator, byte alignment and padding
+	capBits := dataCodewords(ver, l) * 8
+	if t := capBits - bb.n; t > 4 {
+		bb.append(0, 4)
+	} else {
+		bb.append(0, t)
+	}
+	if bb.n%8 != 0 {
+		bb.append(0, 8-bb.n%8)
+	}
+	for pad := 0xec; bb.n < capBits; pad ^= 0xec ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	c := &Code{Version: ver, Level: l, Size: ver*4 + 17}
+	c.modules = make([]bool, c.Size*c.Size)
+	c.function = make([]bool, c.Size*c.Size)
+	c.drawFunction()
+	c.drawCodewords(c.interleave(bb.bytes()))
+	// choose the mask with the lowest penalty
+	best, bestPenalty := 0, -1
+	for m := range masks {
+		c.applyMask(m)
+		c.drawFormat(m)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = m, p
+		}
+		c.applyMask(m)
+	}
+	c.Mask = best
+	c.applyMask(best)
+	c.drawFormat(best)
+	return c, nil
+}
+
+// EncodeKey encodes the otpauth url of k in a QR code with the error correction level l.
+// The url includes the secret.
+func EncodeKey(k otp.Key, l Level) (*Code, error) { return Encode([]byte(k.Url()), l) }
+
+// split the data in blocks, add error correction and interleave the codewords
+func (c *Code) interleave(data []byte) []byte {
+	var (
+		nb       = eccBlocks[c.Level][c.Version]
+		eccLen   = eccPerBlock[c.Level][c.Version]
+		raw      = rawModules(c.Version) / 8
+		nShort   = nb - raw%nb
+		shortLen = raw / nb
+		blocks   = make([][]byte, nb)
+	)
+	for i, k := 0, 0; i < nb; i++ {
+		dl := shortLen - eccLen
+		if i >= nShort {
+			dl++
+		}
+		d := data[k : k+dl]
+		k += dl
+		b := make([]byte, 0, shortLen+1)
+		b = append(b, d...)
+		// short blocks get a placeholder so all blocks have the same length
+		if i < nShort {
+			b = append(b, 0)
+		}
+		blocks[i] = append(b, rsEncode(d, eccLen)...)
+	}
+	r := make([]byte, 0, raw)
+	for i := 0; i <= shortLen; i++ {
+		for j, b := range blocks {
+			if i != shortLen-eccLen || j >= nShort {
+				r = append(r, b[i])
+			}
+		}
+	}
+	return r
+}
+
+// draw the finder, timing and alignment patterns and reserve the format and version areas
+func (c *Code) drawFunction() {
+	// timing patterns
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+	// finder patterns and separators
+	for _, p := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := p[0]+dx, p[1]+dy
+				if x >= 0 && x < c.Size && y >= 0 && y < c.Size {
+					d := max(abs(dx), abs(dy))
+					c.setFunction(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	// alignment patterns, except where they overlap the finder patterns
+	ap := alignmentPositions(c.Version)
+	for i, x := range ap {
+		for j, y := range ap {
+			if i == 0 && j == 0 || i == 0 && j == len(ap)-1 || i == len(ap)-1 && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	// reserve the format information
+	c.drawFormat(0)
+	// version information
+	if c.Version >= 7 {
+		v := versionBits(c.Version)
+		for i := 0; i < 18; i++ {
+			dark := v>>i&1 != 0
+			a, b := c.Size-11+i%3, i/3
+			c.setFunction(a, b, dark)
+			c.setFunction(b, a, dark)
+		}
+	}
+}
+
+// draw the format information
+func (c *Code) drawFormat(mask int) {
+	f := formatBits(c.Level, mask)
+	bit := func(i int) bool { return f>>i&1 != 0 }
+	// top left
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+	// top right and bottom left
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	// dark module
+	c.setFunction(8, c.Size-8, true)
+}
+
+// place the codewords in the zigzag pattern
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// skip the vertical timing pattern
+		if right == 6 {
+			right = 5
+		}
+		for v := 0; v < c.Size; v++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := v
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - v
+				}
+				if !c.function[y*c.Size+x] && i < len(data)*8 {
+					c.modules[y*c.Size+x] = data[i>>3]>>(7-i&7)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// xor the data modules with the mask
+func (c *Code) applyMask(m int) {
+	f := masks[m]
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y*c.Size+x] && f(x, y) {
+				c.modules[y*c.Size+x] = !c.modules[y*c.Size+x]
+			}
+		}
+	}
+}
+
+// penalty score of the current modules (ISO/IEC 18004 7.8.3)
+func (c *Code) penalty() int {
+	p, dark := 0, 0
+	// finder like patterns, with light modules on one side
+	pat1 := []bool{true, false, true, true, true, false, true, false, false, false, false}
+	pat2 := []bool{false, false, false, false, true, false, true, true, true, false, true}
+	matches := func(get func(int) bool, i int, pat []bool) bool {
+		for k, d := range pat {
+			if get(i+k) != d {
+				return false
+			}
+		}
+		return true
+	}
+	for line := 0; line < c.Size; line++ {
+		for _, get := range []func(int) bool{
+			func(i int) bool { return c.Black(i, line) },
+			func(i int) bool { return c.Black(line, i) },
+		} {
+			// runs of the same color
+			run := 1
+			for i := 1; i <= c.Size; i++ {
+				if i < c.Size && get(i) == get(i-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += 3 + run - 5
+				}
+				run = 1
+			}
+			for i := 0; i+len(pat1) <= c.Size; i++ {
+				if matches(get, i, pat1) || matches(get, i, pat2) {
+					p += 40
+				}
+			}
+		}
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			b := c.Black(x, y)
+			if b {
+				dark++
+			}
+			// 2x2 blocks
+			if x+1 < c.Size && y+1 < c.Size && b == c.Black(x+1, y) && b == c.Black(x, y+1) && b == c.Black(x+1, y+1) {
+				p += 3
+			}
+		}
+	}
+	// balance of dark and light modules
+	total := c.Size * c.Size
+	p += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return p
+}
+
+// bit buffer
+type bitBuffer struct {
+	b []byte
+	n int
+}
+
+// append the n low bits of v
+func (bb *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if bb.n%8 == 0 {
+			bb.b = append(bb.b, 0)
+		}
+		if v>>i&1 != 0 {
+			bb.b[bb.n/8] |= 0x80 >> (bb.n % 8)
+		}
+		bb.n++
+	}
+}
+
+func (bb *bitBuffer) bytes() []byte { return bb.b }
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
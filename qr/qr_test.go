@@ -0,0 +1,123 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/heliorosa/otp"
+)
+
+func TestTables(t *testing.T) {
+	for _, dc := range []struct {
+		ver int
+		l   Level
+		n   int
+	}{
+		{1, L, 19}, {1, M, 16}, {1, Q, 13}, {1, H, 9},
+		{5, Q, 62}, {10, L, 274}, {40, L, 2956}, {40, H, 1276},
+	} {
+		if n := dataCodewords(dc.ver, dc.l); n != dc.n {
+			t.Error("wrong data codewords for", dc.ver, dc.l, "expected:", dc.n, "got:", n)
+			return
+		}
+	}
+	if f := formatBits(L, 0); f != 0x77c4 {
+		t.Errorf("wrong format bits: %x", f)
+		return
+	}
+	if v := versionBits(7); v != 0x07c94 {
+		t.Errorf("wrong version bits: %x", v)
+		return
+	}
+	if ap := alignmentPositions(32); len(ap) != 6 || ap[1] != 34 || ap[5] != 138 {
+		t.Error("wrong alignment positions:", ap)
+		return
+	}
+	// "HELLO WORLD", version 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	ecc := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if e := rsEncode(data, 10); !bytes.Equal(e, ecc) {
+		t.Error("wrong error correction:", e)
+		return
+	}
+}
+
+func TestEncode(t *testing.T) {
+	k, err := otp.ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	c, err := EncodeKey(k, DefaultLevel)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if c.Version != 4 || c.Size != 33 || c.Level != M {
+		t.Error("wrong version, size or level:", c.Version, c.Size, c.Level)
+		return
+	}
+	// finder patterns
+	for _, p := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+		if !c.Black(p[0], p[1]) || c.Black(p[0]+1, p[1]+1) || !c.Black(p[0]+3, p[1]+3) {
+			t.Error("missing finder pattern at", p)
+			return
+		}
+	}
+	// higher levels need bigger codes
+	if ch, err := EncodeKey(k, H); err != nil {
+		t.Error(err)
+		return
+	} else if ch.Version <= c.Version {
+		t.Error("expected a bigger version, got:", ch.Version)
+		return
+	}
+	if _, err = Encode(make([]byte, 3000), L); err != ErrTooLong {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	if _, err = Encode(nil, Level(4)); err != ErrInvalidLevel {
+		t.Error("got the wrong error:", err)
+		return
+	}
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode([]byte("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW"), L)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	img := c.Image(3, -1)
+	if b := img.Bounds(); b != image.Rect(0, 0, (c.Size+8)*3, (c.Size+8)*3) {
+		t.Error("wrong image size:", b)
+		return
+	}
+	// quiet zone and top left module
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xffff {
+		t.Error("quiet zone should be white")
+		return
+	}
+	if r, _, _, _ := img.At(12, 12).RGBA(); r != 0 {
+		t.Error("finder pattern should be black")
+		return
+	}
+	svg := c.SVG(2, 1)
+	if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>") || !strings.Contains(svg, fmt.Sprintf(`viewBox="0 0 %d %d"`, c.Size+2, c.Size+2)) || !strings.Contains(svg, `d="M1,1h7v1h-7zM`) {
+		t.Error("wrong svg:", svg)
+		return
+	}
+	term := c.Terminal(0, true)
+	lines := strings.Split(strings.TrimSuffix(term, "\n"), "\n")
+	if len(lines) != (c.Size+1)/2 || len([]rune(lines[0])) != c.Size || !strings.HasPrefix(lines[0], "█▀▀▀▀▀█") {
+		t.Error("wrong terminal output:\n" + term)
+		return
+	}
+	if inv := c.Terminal(0, false); !strings.HasPrefix(inv, " ▄▄▄▄▄ ") {
+		t.Error("wrong terminal output:\n" + inv)
+		return
+	}
+}
@@ -0,0 +1,90 @@
+package qr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Image renders the code with scale pixels per module and a quiet zone of quiet modules.
+// scale <= 0, defaults to 1. quiet < 0, defaults to QuietZone.
+func (c *Code) Image(scale, quiet int) image.Image {
+	scale, quiet = defaults(scale, quiet)
+	n := (c.Size + 2*quiet) * scale
+	img := image.NewGray(image.Rect(0, 0, n, n))
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if c.Black(x/scale-quiet, y/scale-quiet) {
+				img.SetGray(x, y, color.Gray{0})
+			} else {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	return img
+}
+
+// SVG renders the code as an SVG document with scale pixels per module and
+// a quiet zone of quiet modules. scale <= 0, defaults to 1. quiet < 0, defaults to QuietZone.
+func (c *Code) SVG(scale, quiet int) string {
+	scale, quiet = defaults(scale, quiet)
+	n := c.Size + 2*quiet
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n*scale, n*scale, n, n)
+	sb.WriteString(`<rect width="100%" height="100%" fill="#ffffff"/><path fill="#000000" d="`)
+	// one rectangle per horizontal run of dark modules
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Black(x, y) {
+				continue
+			}
+			run := 1
+			for c.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&sb, "M%d,%dh%dv1h-%dz", x+quiet, y+quiet, run, run)
+			x += run
+		}
+	}
+	sb.WriteString(`"/></svg>`)
+	return sb.String()
+}
+
+// Terminal renders the code with UTF-8 half blocks, two rows of modules per line,
+// and a quiet zone of quiet modules. quiet < 0, defaults to QuietZone.
+// The blocks draw the light modules, for terminals with light text on a dark
+// background. invert draws the dark modules instead.
+func (c *Code) Terminal(quiet int, invert bool) string {
+	_, quiet = defaults(1, quiet)
+	lit := func(x, y int) bool { return c.Black(x, y) == invert }
+	var sb strings.Builder
+	for y := -quiet; y < c.Size+quiet; y += 2 {
+		for x := -quiet; x < c.Size+quiet; x++ {
+			top, bottom := lit(x, y), y+1 < c.Size+quiet && lit(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// default scale and quiet zone
+func defaults(scale, quiet int) (int, int) {
+	if scale <= 0 {
+		scale = 1
+	}
+	if quiet < 0 {
+		quiet = QuietZone
+	}
+	return scale, quiet
+}
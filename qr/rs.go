@@ -0,0 +1,113 @@
+package qr
+
+import "errors"
+
+// errUncorrectable is returned when a block has too many errors.
+var errUncorrectable = errors.New("qr: too many errors")
+
+// rsCorrect corrects, in place, the errors in the block b, made of data
+// followed by n error correction codewords. It returns the number of corrected errors.
+func rsCorrect(b []byte, n int) (int, error) {
+	synd, clean := syndromes(b, n)
+	if clean {
+		return 0, nil
+	}
+	// Berlekamp-Massey: error locator polynomial, lowest power first
+	var (
+		lambda = []byte{1}
+		prev   = []byte{1}
+		l      = 0
+		m      = 1
+		pd     = byte(1)
+	)
+	for k := 0; k < n; k++ {
+		d := synd[k]
+		for i := 1; i <= l && i < len(lambda); i++ {
+			d ^= gfMul(lambda[i], synd[k-i])
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+		// lambda - d/pd * x^m * prev
+		f := gfDiv(d, pd)
+		next := make([]byte, max(len(lambda), len(prev)+m))
+		copy(next, lambda)
+		for i, c := range prev {
+			next[i+m] ^= gfMul(f, c)
+		}
+		if 2*l <= k {
+			l, prev, pd, m = k+1-l, lambda, d, 1
+		} else {
+			m++
+		}
+		lambda = next
+	}
+	if 2*l > n {
+		return 0, errUncorrectable
+	}
+	// Chien search: the error at power p has locator 2^p, a root of lambda(2^-p)
+	var pos []int
+	for p := 0; p < len(b); p++ {
+		if polyEval(lambda, gfPow2(-p)) == 0 {
+			pos = append(pos, p)
+		}
+	}
+	if len(pos) != l {
+		return 0, errUncorrectable
+	}
+	// omega = synd * lambda mod x^n
+	omega := make([]byte, n)
+	for i, s := range synd {
+		for j, c := range lambda {
+			if i+j < n {
+				omega[i+j] ^= gfMul(s, c)
+			}
+		}
+	}
+	// formal derivative of lambda
+	dl := make([]byte, len(lambda))
+	for i := 1; i < len(lambda); i += 2 {
+		dl[i-1] = lambda[i]
+	}
+	// Forney: e = X * omega(X^-1) / lambda'(X^-1)
+	for _, p := range pos {
+		xi := gfPow2(-p)
+		den := polyEval(dl, xi)
+		if den == 0 {
+			return 0, errUncorrectable
+		}
+		b[len(b)-1-p] ^= gfMul(gfPow2(p), gfDiv(polyEval(omega, xi), den))
+	}
+	if _, clean = syndromes(b, n); !clean {
+		return 0, errUncorrectable
+	}
+	return l, nil
+}
+
+// syndromes, the codeword evaluated at the roots of the generator, 2^0..2^(n-1),
+// and whether they are all zero
+func syndromes(b []byte, n int) ([]byte, bool) {
+	synd := make([]byte, n)
+	clean := true
+	for j := range synd {
+		var s byte
+		for _, c := range b {
+			s = gfMul(s, gfPow2(j)) ^ c
+		}
+		synd[j] = s
+		if s != 0 {
+			clean = false
+		}
+	}
+	return synd, clean
+}
+
+// evaluate the polynomial p, lowest power first, at x
+func polyEval(p []byte, x byte) byte {
+	var r byte
+	for i := len(p) - 1; i >= 0; i-- {
+		r = gfMul(r, x) ^ p[i]
+	}
+	return r
+}
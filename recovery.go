@@ -0,0 +1,241 @@
+package otp
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Recovery codes defaults.
+const (
+	// Digits and uppercase letters, without 0, 1, I and O.
+	DefaultRecoveryAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+	// 10 characters, 50 bits with the default alphabet.
+	DefaultRecoveryLength = 10
+	// Groups of 5 characters, separated by dashes.
+	DefaultRecoveryGroup = 5
+	// 10 codes.
+	DefaultRecoveryCount = 10
+	// scrypt cost parameters.
+	DefaultScryptN = 1 << 15
+	DefaultScryptR = 8
+	DefaultScryptP = 1
+)
+
+// prefix of the store ids holding recovery codes
+const recoveryPrefix = "recovery:"
+
+// stored recovery codes, only their hashes
+type recoveryData struct {
+	Salt   []byte   `json:"salt"`
+	N      int      `json:"n"`
+	R      int      `json:"r"`
+	P      int      `json:"p"`
+	Hashes [][]byte `json:"hashes"`
+}
+
+// RecoveryCodes generates and verifies one time recovery (backup) codes.
+// Only salted scrypt hashes of the codes are kept in the Store, and each
+// code is consumed when it's verified.
+type RecoveryCodes struct {
+	// Store for the hashes of the codes.
+	Store Store
+	// Characters of the codes. "", defaults to DefaultRecoveryAlphabet.
+	Alphabet string
+	// Characters per code. <= 0, defaults to DefaultRecoveryLength.
+	Length int
+	// Characters per group, groups are separated by dashes. < 0, no groups. 0, defaults to DefaultRecoveryGroup.
+	Group int
+	// scrypt cost parameters of new codes. <= 0, default to DefaultScryptN, DefaultScryptR and DefaultScryptP.
+	ScryptN, ScryptR, ScryptP int
+}
+
+// NewRecoveryCodes creates a *RecoveryCodes with the defaults.
+func NewRecoveryCodes(s Store) *RecoveryCodes { return &RecoveryCodes{Store: s} }
+
+// Generate creates n recovery codes for id, replacing the previous ones.
+// n <= 0, defaults to DefaultRecoveryCount. The codes are only returned here, show them to the user.
+func (rc *RecoveryCodes) Generate(id string, n int) ([]string, error) {
+	if n <= 0 {
+		n = DefaultRecoveryCount
+	}
+	alphabet, length, group := rc.format()
+	d := &recoveryData{Salt: make([]byte, 16), N: rc.ScryptN, R: rc.ScryptR, P: rc.ScryptP}
+	if d.N <= 0 {
+		d.N = DefaultScryptN
+	}
+	if d.R <= 0 {
+		d.R = DefaultScryptR
+	}
+	if d.P <= 0 {
+		d.P = DefaultScryptP
+	}
+	if _, err := rand.Read(d.Salt); err != nil {
+		return nil, &Error{ECCantReadRandom, "error reading random bytes", err}
+	}
+	codes := make([]string, n)
+	for i := range codes {
+		c, err := randomString(alphabet, length)
+		if err != nil {
+			return nil, err
+		}
+		h, err := d.hash(c)
+		if err != nil {
+			return nil, err
+		}
+		d.Hashes = append(d.Hashes, h)
+		codes[i] = groupCode(c, group)
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, &Error{ECStore, fmt.Sprintf("can't encode recovery codes: %v", err), err}
+	}
+	for {
+		_, ver, err := rc.Store.Load(recoveryPrefix + id)
+		if err != nil {
+			return nil, err
+		}
+		if ok, err := rc.Store.CompareAndSwap(recoveryPrefix+id, ver, b); err != nil {
+			return nil, err
+		} else if ok {
+			return codes, nil
+		}
+	}
+}
+
+// Verify checks code against the recovery codes of id, and consumes it if it matches.
+// Dashes, spaces and, if the alphabet has no lowercase letters, case are ignored.
+// It returns the number of codes left.
+func (rc *RecoveryCodes) Verify(id, code string) (int, error) {
+	code = rc.normalize(code)
+	for {
+		d, ver, err := rc.load(id)
+		if err != nil {
+			return 0, err
+		} else if d == nil {
+			return 0, &Error{ECInvalidCode, "no recovery codes", nil}
+		}
+		h, err := d.hash(code)
+		if err != nil {
+			return 0, err
+		}
+		// compare with every hash, in constant time
+		match := -1
+		for i, hh := range d.Hashes {
+			if subtle.ConstantTimeCompare(h, hh) == 1 {
+				match = i
+			}
+		}
+		if match < 0 {
+			return len(d.Hashes), &Error{ECInvalidCode, "invalid recovery code", nil}
+		}
+		d.Hashes = append(d.Hashes[:match], d.Hashes[match+1:]...)
+		b, err := json.Marshal(d)
+		if err != nil {
+			return 0, &Error{ECStore, fmt.Sprintf("can't encode recovery codes: %v", err), err}
+		}
+		// try again if someone else consumed a code, maybe this one
+		if ok, err := rc.Store.CompareAndSwap(recoveryPrefix+id, ver, b); err != nil {
+			return 0, err
+		} else if ok {
+			return len(d.Hashes), nil
+		}
+	}
+}
+
+// Remaining returns the number of recovery codes left for id.
+func (rc *RecoveryCodes) Remaining(id string) (int, error) {
+	d, _, err := rc.load(id)
+	if err != nil || d == nil {
+		return 0, err
+	}
+	return len(d.Hashes), nil
+}
+
+// load the recovery codes of id, nil if there are none
+func (rc *RecoveryCodes) load(id string) (*recoveryData, uint64, error) {
+	b, ver, err := rc.Store.Load(recoveryPrefix + id)
+	if err != nil || b == nil {
+		return nil, ver, err
+	}
+	d := &recoveryData{}
+	if err = json.Unmarshal(b, d); err != nil {
+		return nil, 0, &Error{ECStore, fmt.Sprintf("can't decode recovery codes: %v", err), err}
+	}
+	return d, ver, nil
+}
+
+// alphabet, length and group size, with the defaults
+func (rc *RecoveryCodes) format() (string, int, int) {
+	alphabet, length, group := rc.Alphabet, rc.Length, rc.Group
+	if alphabet == "" {
+		alphabet = DefaultRecoveryAlphabet
+	}
+	if length <= 0 {
+		length = DefaultRecoveryLength
+	}
+	if group == 0 {
+		group = DefaultRecoveryGroup
+	}
+	return alphabet, length, group
+}
+
+// remove the separators and fix the case of a code typed by a user
+func (rc *RecoveryCodes) normalize(code string) string {
+	alphabet, _, _ := rc.format()
+	code = normalizeCode(code)
+	if strings.IndexFunc(alphabet, unicode.IsLower) < 0 {
+		code = strings.ToUpper(code)
+	}
+	return code
+}
+
+// hash a code
+func (d *recoveryData) hash(code string) ([]byte, error) {
+	h, err := scrypt([]byte(code), d.Salt, d.N, d.R, d.P, 32)
+	if err != nil {
+		return nil, &Error{ECInvalidRecoveryParams, fmt.Sprintf("can't hash recovery code: %v", err), err}
+	}
+	return h, nil
+}
+
+// random string of n characters from alphabet, uniformly distributed
+func randomString(alphabet string, n int) (string, error) {
+	chars := []rune(alphabet)
+	if len(chars) < 2 || len(chars) > 256 || strings.ContainsFunc(alphabet, func(r rune) bool { return r == '-' || unicode.IsSpace(r) }) {
+		return "", &Error{ECInvalidRecoveryParams, fmt.Sprintf("invalid recovery alphabet: %q", alphabet), nil}
+	}
+	// reject the bytes that would bias the distribution
+	var (
+		limit = 256 - 256%len(chars)
+		r     = make([]rune, 0, n)
+		buf   = make([]byte, n)
+	)
+	for len(r) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", &Error{ECCantReadRandom, "error reading random bytes", err}
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(r) < n {
+				r = append(r, chars[int(b)%len(chars)])
+			}
+		}
+	}
+	return string(r), nil
+}
+
+// split a code in groups of size characters separated by dashes
+func groupCode(code string, size int) string {
+	if size <= 0 {
+		return code
+	}
+	r := []rune(code)
+	var groups []string
+	for len(r) > size {
+		groups, r = append(groups, string(r[:size])), r[size:]
+	}
+	return strings.Join(append(groups, string(r)), "-")
+}
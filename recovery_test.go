@@ -0,0 +1,179 @@
+package otp
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	s := NewMemoryStore()
+	rc := &RecoveryCodes{Store: s, ScryptN: 16, ScryptR: 1}
+	codes, err := rc.Generate("alice", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(codes) != DefaultRecoveryCount {
+		t.Error("expected", DefaultRecoveryCount, "codes, got", len(codes))
+		return
+	}
+	re := regexp.MustCompile("^[" + DefaultRecoveryAlphabet + "]{5}-[" + DefaultRecoveryAlphabet + "]{5}$")
+	for _, c := range codes {
+		if !re.MatchString(c) {
+			t.Error("invalid code:", c)
+			return
+		}
+	}
+	// only the hashes are stored
+	b, _, err := s.Load(recoveryPrefix + "alice")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, c := range codes {
+		if bytes.Contains(b, []byte(c)) || bytes.Contains(b, []byte(strings.ReplaceAll(c, "-", ""))) {
+			t.Error("the store contains a plain code:", c)
+			return
+		}
+	}
+	// lowercase and without dashes
+	n, err := rc.Verify("alice", strings.ToLower(strings.ReplaceAll(codes[3], "-", "")))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != len(codes)-1 {
+		t.Error("expected", len(codes)-1, "codes left, got", n)
+		return
+	}
+	// consumed
+	if _, err = rc.Verify("alice", codes[3]); !checkError(err, ECInvalidCode) {
+		t.Error("a code should be used once:", err)
+		return
+	}
+	if _, err = rc.Verify("alice", "AAAAA-AAAAA"); !checkError(err, ECInvalidCode) {
+		t.Error("expected ECInvalidCode, got", err)
+		return
+	}
+	if n, err = rc.Verify("alice", codes[0]); err != nil || n != len(codes)-2 {
+		t.Error("expected", len(codes)-2, "codes left, got", n, err)
+		return
+	}
+	if n, err = rc.Remaining("alice"); err != nil || n != len(codes)-2 {
+		t.Error("expected", len(codes)-2, "codes left, got", n, err)
+		return
+	}
+	// regenerating replaces the old codes
+	newCodes, err := rc.Generate("alice", 2)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = rc.Verify("alice", codes[1]); !checkError(err, ECInvalidCode) {
+		t.Error("the old codes should be replaced:", err)
+		return
+	}
+	if n, err = rc.Verify("alice", newCodes[1]); err != nil || n != 1 {
+		t.Error("expected 1 code left, got", n, err)
+		return
+	}
+	// unknown id
+	if n, err = rc.Remaining("bob"); err != nil || n != 0 {
+		t.Error("expected no codes, got", n, err)
+		return
+	}
+	if _, err = rc.Verify("bob", codes[2]); !checkError(err, ECInvalidCode) {
+		t.Error("expected ECInvalidCode, got", err)
+		return
+	}
+}
+
+func TestRecoveryCodesFormat(t *testing.T) {
+	rc := &RecoveryCodes{Store: NewMemoryStore(), Alphabet: "0123456789", Length: 12, Group: 4, ScryptN: 16, ScryptR: 1}
+	codes, err := rc.Generate("alice", 3)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	re := regexp.MustCompile(`^\d{4}-\d{4}-\d{4}$`)
+	for _, c := range codes {
+		if !re.MatchString(c) {
+			t.Error("invalid code:", c)
+			return
+		}
+	}
+	if _, err = rc.Verify("alice", strings.ReplaceAll(codes[0], "-", " ")); err != nil {
+		t.Error(err)
+		return
+	}
+	// no groups, case sensitive
+	rc = &RecoveryCodes{Store: NewMemoryStore(), Alphabet: "abcXYZ", Length: 8, Group: -1, ScryptN: 16, ScryptR: 1}
+	if codes, err = rc.Generate("alice", 1); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(codes[0]) != 8 || strings.Trim(codes[0], "abcXYZ") != "" {
+		t.Error("invalid code:", codes[0])
+		return
+	}
+	if c := strings.ToUpper(codes[0]); c != codes[0] {
+		if _, err = rc.Verify("alice", c); !checkError(err, ECInvalidCode) {
+			t.Error("expected ECInvalidCode, got", err)
+			return
+		}
+	}
+	if _, err = rc.Verify("alice", codes[0]); err != nil {
+		t.Error(err)
+		return
+	}
+	// invalid alphabets and scrypt parameters
+	for _, rc := range []*RecoveryCodes{
+		{Store: NewMemoryStore(), Alphabet: "A", ScryptN: 16, ScryptR: 1},
+		{Store: NewMemoryStore(), Alphabet: "AB-C", ScryptN: 16, ScryptR: 1},
+		{Store: NewMemoryStore(), ScryptN: 15, ScryptR: 1},
+	} {
+		if _, err = rc.Generate("alice", 1); !checkError(err, ECInvalidRecoveryParams) {
+			t.Error("expected ECInvalidRecoveryParams, got", err)
+			return
+		}
+	}
+}
+
+func TestRecoveryCodesConcurrent(t *testing.T) {
+	rc := &RecoveryCodes{Store: NewMemoryStore(), ScryptN: 16, ScryptR: 1}
+	codes, err := rc.Generate("alice", 5)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ok int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rc.Verify("alice", codes[2]); err == nil {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			} else if !checkError(err, ECInvalidCode) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 1 {
+		t.Error("the code should be accepted once, got", ok)
+		return
+	}
+	if n, err := rc.Remaining("alice"); err != nil || n != 4 {
+		t.Error("expected 4 codes left, got", n, err)
+		return
+	}
+}
@@ -0,0 +1,107 @@
+package otp
+
+import "fmt"
+
+// RotateResult is the outcome of rotating one sealed key.
+type RotateResult struct {
+	// Store id of the sealed key.
+	ID string
+	// Label of the key, from the envelope header. Empty if it can't be parsed.
+	Label string
+	// Rotated is true if the key was re-sealed, false if it was skipped or failed.
+	Rotated bool
+	// Err is the reason the key couldn't be rotated.
+	Err error
+}
+
+// Rotator re-seals the keys kept in a Store, sealed by SealKey, with a new key encryption key (KEK).
+// Keys sealed with other KEKs are skipped, so a rotation can be interrupted and run again.
+type Rotator struct {
+	// Store with the sealed keys.
+	Store Store
+	// Encrypter must unwrap the old KEK and wrap with the new one, like a Keyring with the new KEK as primary.
+	Encrypter KeyEncrypter
+	// Progress, if not nil, is called with the result of each key.
+	Progress func(RotateResult)
+}
+
+// NewRotator creates a *Rotator.
+func NewRotator(s Store, e KeyEncrypter) *Rotator { return &Rotator{Store: s, Encrypter: e} }
+
+// Rotate re-seals the keys under the ids that start with prefix, sealed with the KEK oldKeyID.
+// It returns the results of the keys that were rotated or failed; the error is only
+// set when the store can't be listed or the encrypter still wraps with oldKeyID.
+func (r *Rotator) Rotate(prefix, oldKeyID string) ([]RotateResult, error) {
+	ids, err := r.Store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var results []RotateResult
+	for _, id := range ids {
+		res, err := r.rotate(id, oldKeyID)
+		if err != nil {
+			return results, err
+		}
+		if !res.Rotated && res.Err == nil {
+			// sealed with another KEK, or already rotated
+			continue
+		}
+		results = append(results, res)
+		if r.Progress != nil {
+			r.Progress(res)
+		}
+	}
+	return results, nil
+}
+
+// rotate the key under id, the error is only set if the encrypter wraps with oldKeyID
+func (r *Rotator) rotate(id, oldKeyID string) (RotateResult, error) {
+	res := RotateResult{ID: id}
+	for {
+		b, ver, err := r.Store.Load(id)
+		if err != nil {
+			res.Err = err
+			return res, nil
+		} else if b == nil {
+			// deleted since it was listed
+			return res, nil
+		}
+		env, err := ParseKeyEnvelope(b)
+		if err != nil {
+			res.Err = err
+			return res, nil
+		}
+		res.Label = env.AccountName
+		if env.Issuer != "" {
+			res.Label = env.Issuer + ":" + env.AccountName
+		}
+		if env.KeyID != oldKeyID {
+			return res, nil
+		}
+		k, err := OpenKey(b, r.Encrypter)
+		if err != nil {
+			res.Err = err
+			return res, nil
+		}
+		nb, err := SealKey(k, r.Encrypter)
+		if err != nil {
+			res.Err = err
+			return res, nil
+		}
+		// re-sealing with the same KEK would never finish
+		if nenv, err := ParseKeyEnvelope(nb); err != nil {
+			res.Err = err
+			return res, nil
+		} else if nenv.KeyID == oldKeyID {
+			return res, &Error{ECKeyEncrypter, fmt.Sprintf("the key encrypter still wraps with %q", oldKeyID), nil}
+		}
+		// try again if someone else changed the key
+		if ok, err := r.Store.CompareAndSwap(id, ver, nb); err != nil {
+			res.Err = err
+			return res, nil
+		} else if ok {
+			res.Rotated = true
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package otp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRotate(t *testing.T) {
+	keys := map[string][]byte{"k0": bytes.Repeat([]byte{0}, 32), "k1": bytes.Repeat([]byte{1}, 32), "k2": bytes.Repeat([]byte{2}, 32)}
+	old, err := NewKeyring("k1", keys)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	other, err := NewKeyring("k0", keys)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s := NewMemoryStore()
+	put := func(id string, b []byte) bool {
+		if ok, err := s.CompareAndSwap(id, 0, b); err != nil || !ok {
+			t.Error("swap should succeed:", err)
+			return false
+		}
+		return true
+	}
+	urls := map[string]string{}
+	for i, u := range []string{
+		"otpauth://totp/Example:alice?issuer=Example&secret=ADS2OR6Q6K3OJZDW",
+		"otpauth://hotp/bob?counter=3&secret=ADS2OR6Q6K3OJZDW",
+		"otpauth://totp/carol?secret=GEZDGNBVGY3TQOJQ",
+	} {
+		k, err := ImportKey(u)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		b, err := SealKey(k, old)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		id := "key:" + string(rune('a'+i))
+		urls[id] = u
+		if !put(id, b) {
+			return
+		}
+	}
+	// sealed with another KEK, not a key and outside the prefix
+	k, _ := ImportKey("otpauth://totp/dave?secret=ADS2OR6Q6K3OJZDW")
+	b, err := SealKey(k, other)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !put("key:d", b) || !put("key:e", []byte("garbage")) || !put("state:a", []byte("{}")) {
+		return
+	}
+	kr, err := NewKeyring("k2", keys)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	r := NewRotator(s, kr)
+	// the encrypter must wrap with the new KEK
+	if _, err = NewRotator(s, old).Rotate("key:", "k1"); !checkError(err, ECKeyEncrypter) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+	var progress []string
+	r.Progress = func(res RotateResult) { progress = append(progress, res.Label) }
+	res, err := r.Rotate("key:", "k1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 4 || !res[0].Rotated || res[0].Label != "Example:alice" || !res[1].Rotated || !res[2].Rotated || res[3].Rotated || res[3].ID != "key:e" || !checkError(res[3].Err, ECInvalidEnvelope) {
+		t.Error("wrong results:", res)
+		return
+	}
+	if len(progress) != 4 || progress[1] != "bob" {
+		t.Error("wrong progress:", progress)
+		return
+	}
+	for id, u := range urls {
+		b, _, err := s.Load(id)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if env, err := ParseKeyEnvelope(b); err != nil || env.KeyID != "k2" {
+			t.Error("key not rotated:", id, err)
+			return
+		}
+		if k, err := OpenKey(b, kr); err != nil {
+			t.Error(err)
+			return
+		} else if k.Url() != u {
+			t.Error("wrong key:", k.Url())
+			return
+		}
+	}
+	if b, _, _ := s.Load("key:d"); b == nil {
+		t.Error("missing key")
+		return
+	} else if env, err := ParseKeyEnvelope(b); err != nil || env.KeyID != "k0" {
+		t.Error("key sealed with another KEK was rotated")
+		return
+	}
+	// running again only reports the failures
+	if res, err = r.Rotate("key:", "k1"); err != nil {
+		t.Error(err)
+		return
+	} else if len(res) != 1 || res[0].ID != "key:e" {
+		t.Error("wrong results:", res)
+		return
+	}
+}
@@ -0,0 +1,111 @@
+package otp
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// scrypt key derivation (RFC 7914). N must be a power of 2 greater than 1.
+func scrypt(password, salt []byte, n, r, p, keyLen int) ([]byte, error) {
+	if n <= 1 || n&(n-1) != 0 {
+		return nil, errors.New("scrypt: N must be a power of 2 greater than 1")
+	}
+	if r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 || r > (1<<31-1)/128/p || n > (1<<31-1)/128/r {
+		return nil, errors.New("scrypt: parameters are too large")
+	}
+	b, err := pbkdf2.Key(sha256.New, string(password), salt, 1, p*128*r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		x = make([]uint32, 32*r)
+		v = make([]uint32, 32*r*n)
+		y = make([]uint32, 32*r)
+	)
+	for i := 0; i < p; i++ {
+		roMix(b[i*128*r:(i+1)*128*r], r, n, x, y, v)
+	}
+	return pbkdf2.Key(sha256.New, string(password), b, 1, keyLen)
+}
+
+// scryptROMix on the block b, with the scratch space x, y and v
+func roMix(b []byte, r, n int, x, y, v []uint32) {
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	for i := 0; i < n; i++ {
+		copy(v[i*32*r:], x)
+		blockMix(x, y, r)
+	}
+	for i := 0; i < n; i++ {
+		// integerify, the first word of the last 64 byte block
+		j := int(x[(2*r-1)*16] & uint32(n-1))
+		for k, w := range v[j*32*r : (j+1)*32*r] {
+			x[k] ^= w
+		}
+		blockMix(x, y, r)
+	}
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(b[i*4:], w)
+	}
+}
+
+// scryptBlockMix of b, using y as scratch space
+func blockMix(b, y []uint32, r int) {
+	var t [16]uint32
+	copy(t[:], b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		for k := range t {
+			t[k] ^= b[i*16+k]
+		}
+		salsa208(&t)
+		// even blocks first, then odd blocks
+		copy(y[((i&1)*r+i/2)*16:], t[:])
+	}
+	copy(b, y)
+}
+
+// Salsa20/8 core
+func salsa208(b *[16]uint32) {
+	x := *b
+	for i := 0; i < 8; i += 2 {
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+	for i := range b {
+		b[i] += x[i]
+	}
+}
@@ -0,0 +1,32 @@
+package otp
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestScrypt(t *testing.T) {
+	// RFC 7914 section 12
+	for _, v := range []struct {
+		password, salt string
+		n, r, p        int
+		key            string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	} {
+		k, err := scrypt([]byte(v.password), []byte(v.salt), v.n, v.r, v.p, 64)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if hex.EncodeToString(k) != v.key {
+			t.Error("wrong key:", hex.EncodeToString(k))
+			return
+		}
+	}
+	if _, err := scrypt(nil, nil, 15, 1, 1, 32); err == nil {
+		t.Error("an error was expected")
+		return
+	}
+}
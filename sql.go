@@ -0,0 +1,158 @@
+package otp
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// scan the otpauth url in a database column
+func scanUrl(src interface{}) (string, error) {
+	switch s := src.(type) {
+	case string:
+		return s, nil
+	case []byte:
+		return string(s), nil
+	case nil:
+		return "", &Error{ECInvalidEncoding, "can't scan NULL into a key, use NullKey", nil}
+	}
+	return "", &Error{ECInvalidEncoding, fmt.Sprintf("can't scan %T into a key", src), nil}
+}
+
+// is k nil, or a nil *Totp or *Hotp, or without the common fields
+func nilKey(k Key) bool {
+	switch kk := k.(type) {
+	case nil:
+		return true
+	case *Totp:
+		return kk == nil || kk.Common == nil
+	case *Hotp:
+		return kk == nil || kk.Common == nil
+	}
+	return false
+}
+
+// the validated otpauth url of k, NULL if k is nil
+func keyValue(k Key) (driver.Value, error) {
+	if nilKey(k) {
+		return nil, nil
+	}
+	var err error
+	switch kk := k.(type) {
+	case *Totp:
+		err = kk.validate()
+	case *Hotp:
+		err = kk.validate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k.Url(), nil
+}
+
+// Value implements driver.Valuer, storing the validated otpauth url. A nil key stores NULL.
+func (t *Totp) Value() (driver.Value, error) { return keyValue(t) }
+
+// Scan implements sql.Scanner, importing an otpauth url.
+func (t *Totp) Scan(src interface{}) error {
+	u, err := scanUrl(src)
+	if err != nil {
+		return err
+	}
+	return t.UnmarshalText([]byte(u))
+}
+
+// Value implements driver.Valuer, storing the validated otpauth url. A nil key stores NULL.
+func (h *Hotp) Value() (driver.Value, error) { return keyValue(h) }
+
+// Scan implements sql.Scanner, importing an otpauth url.
+func (h *Hotp) Scan(src interface{}) error {
+	u, err := scanUrl(src)
+	if err != nil {
+		return err
+	}
+	return h.UnmarshalText([]byte(u))
+}
+
+// NullKey is a Key of either type that may be NULL, for database columns.
+type NullKey struct {
+	Key Key
+	// Valid is true if Key is not NULL.
+	Valid bool
+}
+
+// Value implements driver.Valuer, storing the validated otpauth url or NULL.
+func (n NullKey) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return keyValue(n.Key)
+}
+
+// Scan implements sql.Scanner, importing an otpauth url of either type.
+func (n *NullKey) Scan(src interface{}) error {
+	if src == nil {
+		n.Key, n.Valid = nil, false
+		return nil
+	}
+	u, err := scanUrl(src)
+	if err != nil {
+		return err
+	}
+	if n.Key, err = ImportKey(u); err != nil {
+		n.Valid = false
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// SealedKey is a Key of either type stored in a database column sealed by SealKey.
+type SealedKey struct {
+	Key Key
+	// Encrypter wraps and unwraps the data keys. Required.
+	Encrypter KeyEncrypter
+}
+
+// Value implements driver.Valuer, storing the sealed key.
+func (s SealedKey) Value() (driver.Value, error) {
+	if nilKey(s.Key) {
+		return nil, nil
+	}
+	return SealKey(s.Key, s.Encrypter)
+}
+
+// Scan implements sql.Scanner, opening a sealed key.
+// NULL sets Key to nil.
+func (s *SealedKey) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		s.Key = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return &Error{ECInvalidEncoding, fmt.Sprintf("can't scan %T into a sealed key", src), nil}
+	}
+	k, err := OpenKey(b, s.Encrypter)
+	if err != nil {
+		return err
+	}
+	s.Key = k
+	return nil
+}
+
+// ensure that we implement the database/sql interfaces
+var (
+	_ sql.Scanner   = (*Totp)(nil)
+	_ driver.Valuer = (*Totp)(nil)
+	_ sql.Scanner   = (*Hotp)(nil)
+	_ driver.Valuer = (*Hotp)(nil)
+	_ sql.Scanner   = (*NullKey)(nil)
+	_ driver.Valuer = NullKey{}
+	_ sql.Scanner   = (*SealedKey)(nil)
+	_ driver.Valuer = SealedKey{}
+)
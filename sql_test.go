@@ -0,0 +1,139 @@
+package otp
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestSQL(t *testing.T) {
+	const u = "otpauth://totp/Example:alice?issuer=Example&secret=ADS2OR6Q6K3OJZDW"
+	kt := &Totp{}
+	if err := kt.Scan([]byte(u)); err != nil {
+		t.Error(err)
+		return
+	}
+	// drivers convert the parameters with the default converter
+	if v, err := driver.DefaultParameterConverter.ConvertValue(kt); err != nil {
+		t.Error(err)
+		return
+	} else if v != u {
+		t.Error("wrong value:", v)
+		return
+	}
+	kh := &Hotp{}
+	if err := kh.Scan("otpauth://hotp/alice?counter=4&secret=ADS2OR6Q6K3OJZDW"); err != nil {
+		t.Error(err)
+		return
+	} else if v, _ := kh.Value(); v != "otpauth://hotp/alice?counter=4&secret=ADS2OR6Q6K3OJZDW" {
+		t.Error("wrong value:", v)
+		return
+	}
+	// nil keys are NULL
+	for _, v := range []interface{}{(*Totp)(nil), &Totp{}, (*Hotp)(nil), &Hotp{}, NullKey{(*Totp)(nil), true}, SealedKey{Key: (*Hotp)(nil)}} {
+		if v, err := driver.DefaultParameterConverter.ConvertValue(v); err != nil || v != nil {
+			t.Error("expected NULL, got:", v, err)
+			return
+		}
+	}
+	// invalid keys aren't stored
+	for _, v := range []struct {
+		k  interface{}
+		ec ErrorCode
+	}{
+		{&Totp{Common: &Common{Key: []byte("k"), AccountName: "a", Algorithm: "md5", Digits: 6}}, ECInvalidAlgorithm},
+		{&Totp{Common: &Common{AccountName: "a", Digits: 6}}, ECMissingSecret},
+		{&Hotp{Common: &Common{Key: []byte("k"), AccountName: "a"}}, ECInvalidDigits},
+		{&Hotp{Common: &Common{Key: []byte("k"), AccountName: "a:b", Digits: 6}}, ECInvalidLabel},
+		{NullKey{&Totp{Common: &Common{Key: []byte("k"), Digits: 6}}, true}, ECMissingLabel},
+		{SealedKey{&Totp{Common: &Common{AccountName: "a", Digits: 6}}, nil}, ECMissingSecret},
+	} {
+		if _, err := driver.DefaultParameterConverter.ConvertValue(v.k); !checkError(err, v.ec) {
+			t.Error("got the wrong error for", v.k, err)
+			return
+		}
+	}
+	// errors
+	for _, v := range []struct {
+		src interface{}
+		ec  ErrorCode
+	}{
+		{nil, ECInvalidEncoding},
+		{42, ECInvalidEncoding},
+		{"otpauth://totp/alice", ECMissingSecret},
+		{"otpauth://hotp/alice?counter=4&secret=ADS2OR6Q6K3OJZDW", ECNotTotp},
+	} {
+		if err := (&Totp{}).Scan(v.src); !checkError(err, v.ec) {
+			t.Errorf("got the wrong error for %v: %v", v.src, err)
+			return
+		}
+	}
+	// nullable keys of either type
+	var n NullKey
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Error("expected a NULL key:", err)
+		return
+	}
+	if v, err := n.Value(); err != nil || v != nil {
+		t.Error("wrong value:", v, err)
+		return
+	}
+	if err := n.Scan(u); err != nil || !n.Valid {
+		t.Error("expected a valid key:", err)
+		return
+	}
+	if _, ok := n.Key.(*Totp); !ok {
+		t.Error("expected a totp key")
+		return
+	}
+	if v, err := driver.DefaultParameterConverter.ConvertValue(n); err != nil || v != u {
+		t.Error("wrong value:", v, err)
+		return
+	}
+	if err := n.Scan("otpauth://xotp/alice?secret=ADS2OR6Q6K3OJZDW"); !checkError(err, ECInvalidOtpType) || n.Valid {
+		t.Error("got the wrong error:", err)
+		return
+	}
+}
+
+func TestSealedKey(t *testing.T) {
+	se, err := NewStaticKeyEncrypter("static", make([]byte, 32))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kt, err := ImportTotp("otpauth://totp/alice?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	v, err := driver.DefaultParameterConverter.ConvertValue(SealedKey{kt, se})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		t.Errorf("wrong value type: %T", v)
+		return
+	}
+	s := &SealedKey{Encrypter: se}
+	if err = s.Scan(b); err != nil {
+		t.Error(err)
+		return
+	} else if s.Key.Url() != kt.Url() {
+		t.Error("wrong key:", s.Key.Url())
+		return
+	}
+	if err = s.Scan(nil); err != nil || s.Key != nil {
+		t.Error("expected a NULL key:", err)
+		return
+	}
+	if v, err = (SealedKey{Encrypter: se}).Value(); err != nil || v != nil {
+		t.Error("wrong value:", v, err)
+		return
+	}
+	if err = s.Scan(kt.Url()); !checkError(err, ECInvalidEnvelope) {
+		t.Error("got the wrong error:", err)
+		return
+	}
+}
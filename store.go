@@ -0,0 +1,240 @@
+package otp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store persists values, such as the verification state of keys, between requests.
+// Every value has a version that changes on each write, so concurrent
+// updates can be detected with CompareAndSwap.
+type Store interface {
+	// Load returns the value stored under id and its version.
+	// A missing id returns a nil value and version 0.
+	Load(id string) ([]byte, uint64, error)
+	// CompareAndSwap stores value under id, if the current version of id is version,
+	// and reports whether it did. A nil value deletes id.
+	CompareAndSwap(id string, version uint64, value []byte) (bool, error)
+	// List returns the ids that start with prefix, sorted.
+	List(prefix string) ([]string, error)
+}
+
+// stored value
+type storeEntry struct {
+	Version uint64 `json:"version"`
+	Value   []byte `json:"value"`
+}
+
+// store contents
+type storeData struct {
+	// last version used
+	Seq     uint64                `json:"seq"`
+	Entries map[string]storeEntry `json:"entries"`
+}
+
+// compare and swap on the store contents
+func (d *storeData) cas(id string, version uint64, value []byte) bool {
+	if d.Entries[id].Version != version {
+		return false
+	}
+	if value == nil {
+		delete(d.Entries, id)
+		return true
+	}
+	if d.Entries == nil {
+		d.Entries = map[string]storeEntry{}
+	}
+	// versions are never reused, not even after a delete
+	d.Seq++
+	d.Entries[id] = storeEntry{d.Seq, append([]byte(nil), value...)}
+	return true
+}
+
+// sorted ids that start with prefix
+func (d *storeData) list(prefix string) []string {
+	var ids []string
+	for id := range d.Entries {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// MemoryStore is a Store that keeps the values in memory.
+type MemoryStore struct {
+	mtx  sync.Mutex
+	data storeData
+}
+
+// NewMemoryStore creates an empty *MemoryStore.
+func NewMemoryStore() *MemoryStore { return &MemoryStore{} }
+
+// Load implements Store.
+func (s *MemoryStore) Load(id string) ([]byte, uint64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	e, ok := s.data.Entries[id]
+	if !ok {
+		return nil, 0, nil
+	}
+	return append([]byte(nil), e.Value...), e.Version, nil
+}
+
+// CompareAndSwap implements Store.
+func (s *MemoryStore) CompareAndSwap(id string, version uint64, value []byte) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.data.cas(id, version, value), nil
+}
+
+// List implements Store.
+func (s *MemoryStore) List(prefix string) ([]string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.data.list(prefix), nil
+}
+
+// FileStore defaults.
+const (
+	// Default time to wait for the lock file.
+	DefaultLockTimeout = 10 * time.Second
+)
+
+// FileStore is a Store that keeps the values in a JSON file.
+// Writes are serialized, across processes, with an advisory lock on a lock file (Path + ".lock"),
+// released by the OS if the process dies, and the file is replaced atomically and synced to disk on every write.
+type FileStore struct {
+	// Path of the JSON file.
+	Path string
+	// Time to wait for the lock file. <= 0, defaults to DefaultLockTimeout.
+	LockTimeout time.Duration
+
+	mtx sync.Mutex
+}
+
+// NewFileStore creates a *FileStore for the file path.
+// The file is created on the first write.
+func NewFileStore(path string) *FileStore { return &FileStore{Path: path} }
+
+// read the store contents
+func (s *FileStore) read() (*storeData, error) {
+	d := &storeData{}
+	b, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return d, nil
+	} else if err != nil {
+		return nil, &Error{ECStore, fmt.Sprintf("can't read store: %v", err), err}
+	}
+	if err = json.Unmarshal(b, d); err != nil {
+		return nil, &Error{ECStore, fmt.Sprintf("can't decode store: %v", err), err}
+	}
+	return d, nil
+}
+
+// write the store contents to a temporary file, sync it and move it in place
+func (s *FileStore) write(d *storeData) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return &Error{ECStore, fmt.Sprintf("can't encode store: %v", err), err}
+	}
+	dir := filepath.Dir(s.Path)
+	f, err := os.CreateTemp(dir, filepath.Base(s.Path)+".tmp*")
+	if err != nil {
+		return &Error{ECStore, fmt.Sprintf("can't write store: %v", err), err}
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.Path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return &Error{ECStore, fmt.Sprintf("can't write store: %v", err), err}
+	}
+	// sync the directory so the rename is durable, not supported everywhere
+	if df, err := os.Open(dir); err == nil {
+		df.Sync()
+		df.Close()
+	}
+	return nil
+}
+
+// acquire the lock file
+func (s *FileStore) lock() (func(), error) {
+	timeout := s.LockTimeout
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		unlock, ok, err := lockFile(s.Path+".lock", timeout)
+		if err != nil {
+			return nil, &Error{ECStore, fmt.Sprintf("can't lock the lock file: %v", err), err}
+		} else if ok {
+			return unlock, nil
+		} else if time.Now().After(deadline) {
+			return nil, &Error{ECStore, "timeout waiting for the lock file", nil}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Load implements Store.
+func (s *FileStore) Load(id string) ([]byte, uint64, error) {
+	// the file is replaced atomically, no need to lock
+	d, err := s.read()
+	if err != nil {
+		return nil, 0, err
+	}
+	e := d.Entries[id]
+	return e.Value, e.Version, nil
+}
+
+// CompareAndSwap implements Store.
+func (s *FileStore) CompareAndSwap(id string, version uint64, value []byte) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	d, err := s.read()
+	if err != nil {
+		return false, err
+	}
+	if !d.cas(id, version, value) {
+		return false, nil
+	}
+	if err = s.write(d); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// List implements Store.
+func (s *FileStore) List(prefix string) ([]string, error) {
+	d, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return d.list(prefix), nil
+}
+
+// ensure that we implement Store
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*FileStore)(nil)
+)
@@ -0,0 +1,174 @@
+package otp
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T, s Store) bool {
+	// missing id
+	if b, ver, err := s.Load("a"); err != nil {
+		t.Error(err)
+		return false
+	} else if b != nil || ver != 0 {
+		t.Error("expected a missing value")
+		return false
+	}
+	// create
+	if ok, err := s.CompareAndSwap("a", 0, []byte("1")); err != nil {
+		t.Error(err)
+		return false
+	} else if !ok {
+		t.Error("swap should succeed")
+		return false
+	}
+	b, ver, err := s.Load("a")
+	if err != nil {
+		t.Error(err)
+		return false
+	} else if string(b) != "1" || ver == 0 {
+		t.Error("got the wrong value:", string(b), ver)
+		return false
+	}
+	// stale version
+	if ok, err := s.CompareAndSwap("a", 0, []byte("2")); err != nil {
+		t.Error(err)
+		return false
+	} else if ok {
+		t.Error("swap should fail")
+		return false
+	}
+	// delete
+	if ok, err := s.CompareAndSwap("a", ver, nil); err != nil {
+		t.Error(err)
+		return false
+	} else if !ok {
+		t.Error("swap should succeed")
+		return false
+	}
+	if b, _, err = s.Load("a"); err != nil {
+		t.Error(err)
+		return false
+	} else if b != nil {
+		t.Error("value should be deleted")
+		return false
+	}
+	// list
+	for _, id := range []string{"key:b", "state:a", "key:a"} {
+		if ok, err := s.CompareAndSwap(id, 0, []byte("1")); err != nil || !ok {
+			t.Error("swap should succeed:", err)
+			return false
+		}
+	}
+	if ids, err := s.List("key:"); err != nil {
+		t.Error(err)
+		return false
+	} else if len(ids) != 2 || ids[0] != "key:a" || ids[1] != "key:b" {
+		t.Error("wrong ids:", ids)
+		return false
+	}
+	if ids, err := s.List("none:"); err != nil || len(ids) != 0 {
+		t.Error("expected no ids:", ids, err)
+		return false
+	}
+	return true
+}
+
+// increment a counter concurrently with CAS
+func testStoreConcurrent(t *testing.T, stores ...Store) bool {
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(s Store) {
+			defer wg.Done()
+			for {
+				b, ver, err := s.Load("ctr")
+				if err != nil {
+					errs <- err
+					return
+				}
+				c, _ := strconv.Atoi(string(b))
+				if ok, err := s.CompareAndSwap("ctr", ver, []byte(strconv.Itoa(c+1))); err != nil {
+					errs <- err
+					return
+				} else if ok {
+					return
+				}
+			}
+		}(stores[i%len(stores)])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+		return false
+	}
+	b, _, err := stores[0].Load("ctr")
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+	if string(b) != strconv.Itoa(n) {
+		t.Error("counter should be", n, "got:", string(b))
+		return false
+	}
+	return true
+}
+
+func TestMemoryStore(t *testing.T) {
+	if !testStore(t, NewMemoryStore()) {
+		return
+	}
+	testStoreConcurrent(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "store.json")
+	if !testStore(t, NewFileStore(p)) {
+		return
+	}
+	// two stores sharing the same file behave like two processes
+	testStoreConcurrent(t, NewFileStore(p), NewFileStore(p))
+}
+
+func TestFileStoreLock(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "store.json")
+	s := &FileStore{Path: p, LockTimeout: 200 * time.Millisecond}
+	// a lock file left behind by a process that died
+	if err := os.WriteFile(p+".lock", []byte("12345\n"), 0600); err != nil {
+		t.Error(err)
+		return
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(p+".lock", old, old); err != nil {
+		t.Error(err)
+		return
+	}
+	if ok, err := s.CompareAndSwap("a", 0, []byte("1")); err != nil || !ok {
+		t.Error("swap should succeed:", err)
+		return
+	}
+	// a lock held by another process
+	unlock, ok, err := lockFile(p+".lock", time.Hour)
+	if err != nil || !ok {
+		t.Error("can't lock:", err)
+		return
+	}
+	_, ver, _ := s.Load("a")
+	if _, err = s.CompareAndSwap("a", ver, []byte("2")); !checkError(err, ECStore) {
+		unlock()
+		t.Error("expected a lock timeout, got:", err)
+		return
+	}
+	unlock()
+	if ok, err := s.CompareAndSwap("a", ver, []byte("2")); err != nil || !ok {
+		t.Error("swap should succeed:", err)
+		return
+	}
+}
@@ -3,7 +3,9 @@ package otp
 import (
 	"encoding/binary"
 	"fmt"
+	"log/slog"
 	"math"
+	"math/big"
 	"net/url"
 	"strconv"
 	"time"
@@ -12,21 +14,38 @@ import (
 // TOTP specific defaults.
 const (
 	// Default period is 30 seconds.
-	DefaultPeriod = 30
+	DefaultPeriod = 30 * time.Second
+	// Shortest period is 1 millisecond, shorter ones are likely seconds passed as a time.Duration.
+	MinPeriod = time.Millisecond
+	// Default largest clock drift is 10 periods, 5 minutes with the default period.
+	DefaultMaxDrift = 10
 )
 
 // Totp key.
 type Totp struct {
 	// common fields
 	*Common
-	// Period in seconds
-	Period int
+	// Period. <= 0, defaults to 30 seconds
+	Period time.Duration
+	// Start time to count periods from (T0). Zero, defaults to the Unix epoch
+	T0 time.Time
+	// Last accepted time step, only meaningful if Used
+	LastStep int
+	// Used is true once a time step was accepted
+	Used bool
+	// Clock drift, in periods, of the client (RFC 6238 section 6)
+	Drift int
+	// Clock used by Code and CodeN. nil, defaults to SystemClock.
+	Clock Clock
 }
 
 // NewTotp creates a new TOTP key.
 // keyLen <= 0, defaults to 10. digits <= 0, defaults to 6.
-// period <= 0, defaults to 30. algorithm == "", defaults to "sha1".
-func NewTotp(keyLen int, label, issuer, algorithm string, digits, period int) (*Totp, error) {
+// period <= 0, defaults to 30 seconds, shorter than MinPeriod is an error. algorithm == "", defaults to "sha1".
+func NewTotp(keyLen int, label, issuer, algorithm string, digits int, period time.Duration) (*Totp, error) {
+	if period > 0 && period < MinPeriod {
+		return nil, &Error{ECInvalidPeriod, fmt.Sprintf("invalid period: %v, shorter than %v", period, MinPeriod), nil}
+	}
 	k, err := newCommon(keyLen, label, issuer, algorithm, digits)
 	if err != nil {
 		return nil, err
@@ -36,7 +55,7 @@ func NewTotp(keyLen int, label, issuer, algorithm string, digits, period int) (*
 	if period > 0 {
 		p = period
 	}
-	return &Totp{k, p}, nil
+	return &Totp{Common: k, Period: p}, nil
 }
 
 // NewTotpWithDefaults calls NewTotp() with the default values.
@@ -47,21 +66,54 @@ func NewTotpWithDefaults(label, issuer string) (*Totp, error) {
 // import totp url
 func importTotp(k *Common, p url.Values) (*Totp, error) {
 	r := &Totp{Common: k}
-	// period
-	td := p.Get("period")
-	if td == "" {
-		r.Period = DefaultPeriod
-	} else if i, err := strconv.Atoi(td); err != nil {
-		return nil, &Error{ECInvalidPeriod, fmt.Sprintf("invalid period: %v", td), err}
-	} else {
-		r.Period = i
+	var err error
+	if r.Period, r.T0, err = parseTotpParams(p, false); err != nil {
+		return nil, err
 	}
+	k.setParams(p, totpParams...)
 	return r, nil
 }
 
+// parameters used by totp keys
+var totpParams = []string{"period", "t0"}
+
+// parse the period (seconds, fractions allowed) and t0 (Unix time) parameters.
+// zeroDefault maps a 0 period to the default, otherwise it's an error.
+func parseTotpParams(p url.Values, zeroDefault bool) (period time.Duration, t0 time.Time, err error) {
+	period = DefaultPeriod
+	if td := p.Get("period"); td != "" {
+		f, perr := strconv.ParseFloat(td, 64)
+		if perr != nil {
+			err = &Error{ECInvalidPeriod, fmt.Sprintf("invalid period: %v", td), perr}
+			return
+		} else if f == 0 && zeroDefault {
+			period = DefaultPeriod
+		} else if period = time.Duration(math.Round(f * float64(time.Second))); period < MinPeriod {
+			err = &Error{ECInvalidPeriod, fmt.Sprintf("invalid period: %v", td), nil}
+			return
+		}
+	}
+	if ts := p.Get("t0"); ts != "" {
+		i, perr := strconv.ParseInt(ts, 10, 64)
+		if perr != nil {
+			err = &Error{ECInvalidT0, fmt.Sprintf("invalid t0: %v", ts), perr}
+			return
+		}
+		t0 = time.Unix(i, 0)
+	}
+	return
+}
+
 // ImportTotp imports an url in the otpauth format.
-func ImportTotp(u string) (*Totp, error) {
-	k, t, p, err := importCommon(u)
+// Lowercase, unpadded, secrets with spaces or dashes are accepted.
+func ImportTotp(u string) (*Totp, error) { return importTotpUrl(u, false) }
+
+// ImportTotpStrict imports an url in the otpauth format with a padded, uppercase, base32 secret.
+func ImportTotpStrict(u string) (*Totp, error) { return importTotpUrl(u, true) }
+
+// import a totp url
+func importTotpUrl(u string, strict bool) (*Totp, error) {
+	k, t, p, err := importCommon(u, strict)
 	if err != nil {
 		return nil, err
 	}
@@ -72,10 +124,36 @@ func ImportTotp(u string) (*Totp, error) {
 }
 
 // Url returns the key in otpauth format.
-func (t *Totp) Url() string { return t.url(TypeTotp, url.Values{}) }
+func (t *Totp) Url() string { return t.url(TypeTotp, t.urlParams(), false) }
 
-// String returns the same as Url().
-func (t *Totp) String() string { return t.Url() }
+// UrlPadded returns the same as Url(), with the secret padded, for apps that require it.
+func (t *Totp) UrlPadded() string { return t.url(TypeTotp, t.urlParams(), true) }
+
+// totp url parameters
+func (t *Totp) urlParams() url.Values {
+	p := url.Values{}
+	if pd := t.period(); pd != DefaultPeriod {
+		p.Set("period", strconv.FormatFloat(pd.Seconds(), 'f', -1, 64))
+	}
+	if !t.T0.IsZero() && t.T0.Unix() != 0 {
+		p.Set("t0", strconv.FormatInt(t.T0.Unix(), 10))
+	}
+	return p
+}
+
+// String returns the same as Url(), with the secret redacted.
+func (t *Totp) String() string { return redactUrl(t.Url()) }
+
+// GoString returns the fields of the key with the secret redacted.
+func (t *Totp) GoString() string {
+	return fmt.Sprintf("&otp.Totp{Common:%#v, Period:%v, T0:%v, LastStep:%d, Used:%v, Drift:%d}", t.Common, t.Period, t.T0, t.LastStep, t.Used, t.Drift)
+}
+
+// LogValue implements slog.LogValuer, logging everything but the secret.
+func (t *Totp) LogValue() slog.Value {
+	attrs := append([]slog.Attr{slog.String("type", TypeTotp)}, t.logAttrs()...)
+	return slog.GroupValue(append(attrs, slog.Duration("period", t.period()))...)
+}
 
 // CodePeriod returns the code for the period p.
 func (t *Totp) CodePeriod(p int) int {
@@ -84,15 +162,78 @@ func (t *Totp) CodePeriod(p int) int {
 }
 
 // CodeTime returns the code for the time tm.
-func (t *Totp) CodeTime(tm time.Time) int { return t.CodePeriod(int(tm.Unix() / int64(t.Period))) }
+func (t *Totp) CodeTime(tm time.Time) int { return t.CodePeriod(t.step(tm)) }
 
-var timeNow = time.Now
+// returns the current time from the key's clock.
+func (t *Totp) now() time.Time { return clockOrSystem(t.Clock).Now() }
 
 // Code returns the current code.
-func (t *Totp) Code() int { return t.CodeTime(timeNow()) }
+func (t *Totp) Code() int { return t.CodeTime(t.now()) }
 
 // CodeN returns the code for the current period+n.
-func (t *Totp) CodeN(n int) int { return t.CodePeriod(int(timeNow().Unix())/t.Period + n) }
+func (t *Totp) CodeN(n int) int { return t.CodePeriod(t.step(t.now()) + n) }
+
+// CodePeriodString returns the code for the period p, zero padded to Digits.
+func (t *Totp) CodePeriodString(p int) string { return formatCode(t.CodePeriod(p), t.Digits) }
+
+// CodeTimeString returns the code for the time tm, zero padded to Digits.
+func (t *Totp) CodeTimeString(tm time.Time) string { return t.CodePeriodString(t.step(tm)) }
+
+// CodeString returns the current code, zero padded to Digits.
+func (t *Totp) CodeString() string { return t.CodeTimeString(t.now()) }
+
+// CodeNString returns the code for the current period+n, zero padded to Digits.
+func (t *Totp) CodeNString(n int) string { return t.CodePeriodString(t.step(t.now()) + n) }
 
 // Type returns TypeTotp.
 func (t *Totp) Type() string { return TypeTotp }
+
+// Verify checks code against the codes for the periods in the window around the period of at,
+// shifted by Drift. It returns the offset, relative to the period of at, of the matching period.
+func (t *Totp) Verify(code string, at time.Time, opts *VerifyOpts) (int, error) {
+	ofs, err := verifyWindow(code, t.step(at)+t.Drift, opts, t.CodePeriodString)
+	if err != nil {
+		return 0, err
+	}
+	return ofs + t.Drift, nil
+}
+
+// Accept checks code like Verify and, on success, records the matching time step in LastStep
+// and its offset in Drift, up to opts.MaxDrift either way, and sets Used. Once Used, codes for steps up to LastStep are rejected with ECReplayed.
+func (t *Totp) Accept(code string, at time.Time, opts *VerifyOpts) (int, error) {
+	step := t.step(at)
+	ofs, err := t.Verify(code, at, opts)
+	if err != nil {
+		return 0, err
+	}
+	// steps can be 0 or negative with t0, don't rely on LastStep alone
+	if t.Used && step+ofs <= t.LastStep {
+		return 0, &Error{ECReplayed, "code already used", nil}
+	}
+	t.LastStep, t.Used = step+ofs, true
+	// keep the drift bounded, or edge matches would move the window forever
+	t.Drift = max(-opts.maxDrift(), min(ofs, opts.maxDrift()))
+	return ofs, nil
+}
+
+// returns the period, or the default if it's not set.
+func (t *Totp) period() time.Duration {
+	if t.Period <= 0 {
+		return DefaultPeriod
+	}
+	return t.Period
+}
+
+// returns the time step for tm: floor((tm - T0) / period).
+func (t *Totp) step(tm time.Time) int {
+	t0 := t.T0
+	if t0.IsZero() {
+		t0 = time.Unix(0, 0)
+	}
+	// time.Duration overflows after ~292 years, count nanoseconds with big.Int
+	d := big.NewInt(tm.Unix() - t0.Unix())
+	d.Mul(d, big.NewInt(int64(time.Second)))
+	d.Add(d, big.NewInt(int64(tm.Nanosecond()-t0.Nanosecond())))
+	// Div rounds towards -inf for positive divisors
+	return int(d.Div(d, big.NewInt(int64(t.period()))).Int64())
+}
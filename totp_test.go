@@ -1,6 +1,7 @@
 package otp
 
 import (
+	"fmt"
 	"testing"
 	"time"
 )
@@ -16,10 +17,15 @@ func TestTotp(t *testing.T) {
 		return
 	}
 	// create a new key
-	if k, err = NewTotp(10, "mydomain.com", "", "", 6, 30); err != nil {
+	if k, err = NewTotp(10, "mydomain.com", "", "", 6, 30*time.Second); err != nil {
 		t.Error(err)
 		return
 	}
+	// seconds passed as a time.Duration
+	if _, err = NewTotp(10, "mydomain.com", "", "", 6, 30); !checkError(err, ECInvalidPeriod) {
+		t.Error("got the wrong error:", err)
+		return
+	}
 	// import error
 	if k, err = ImportTotp(""); err == nil {
 		t.Error("an error was expected, got nil")
@@ -33,7 +39,7 @@ func TestTotp(t *testing.T) {
 	// check values
 	kt := k.(*Totp)
 	// same label ?
-	if kt.Label != "mydomain.com" {
+	if kt.AccountName != "mydomain.com" {
 		t.Error("got a different label")
 		return
 	}
@@ -43,7 +49,7 @@ func TestTotp(t *testing.T) {
 		return
 	}
 	// same period ?
-	if kt.Period != 60 {
+	if kt.Period != time.Minute {
 		t.Error("period should be 60")
 		return
 	}
@@ -65,7 +71,7 @@ func TestTotp(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	if kt.String() != otpUrl {
+	if kt.Url() != otpUrl {
 		t.Error("the url is different than expected")
 		return
 	}
@@ -82,14 +88,255 @@ func TestTotp(t *testing.T) {
 			return
 		}
 	}
-	timeNow = func() time.Time { return time.Unix(int64(kt.Period), 0) }
+	clk := NewFakeClock(time.Unix(0, 0).Add(kt.Period))
+	kt.Clock = clk
 	if kt.Code() != periodCodes[0].c {
 		t.Error("got the wrong code")
 		return
 	}
-	timeNow = func() time.Time { return time.Unix(0, 0) }
+	clk.Set(time.Unix(0, 0))
 	if kt.CodeN(periodCodes[0].p) != periodCodes[0].c {
 		t.Error("got the wrong code")
 		return
 	}
+	clk.Advance(kt.Period)
+	if kt.Code() != periodCodes[0].c {
+		t.Error("got the wrong code")
+		return
+	}
+}
+
+func TestTotpRFC6238(t *testing.T) {
+	// RFC 6238 Appendix B seeds
+	keys := map[string][]byte{
+		"sha1":   []byte("12345678901234567890"),
+		"sha256": []byte("12345678901234567890123456789012"),
+		"sha512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	vectors := []struct {
+		t    int64
+		algo string
+		code int
+	}{
+		{59, "sha1", 94287082},
+		{59, "sha256", 46119246},
+		{59, "sha512", 90693936},
+		{1111111109, "sha1", 7081804},
+		{1111111109, "sha256", 68084774},
+		{1111111109, "sha512", 25091201},
+		{1111111111, "sha1", 14050471},
+		{1111111111, "sha256", 67062674},
+		{1111111111, "sha512", 99943326},
+		{1234567890, "sha1", 89005924},
+		{1234567890, "sha256", 91819424},
+		{1234567890, "sha512", 93441116},
+		{2000000000, "sha1", 69279037},
+		{2000000000, "sha256", 90698825},
+		{2000000000, "sha512", 38618901},
+		{20000000000, "sha1", 65353130},
+		{20000000000, "sha256", 77737706},
+		{20000000000, "sha512", 47863826},
+	}
+	for _, v := range vectors {
+		k := &Totp{
+			Common: &Common{Key: keys[v.algo], AccountName: "rfc6238", Algorithm: v.algo, Digits: 8},
+			Period: DefaultPeriod,
+		}
+		if code := k.CodeTime(time.Unix(v.t, 0)); code != v.code {
+			t.Error("got the wrong code for", v.algo, "at", v.t, "expected:", v.code, "got:", code)
+			return
+		}
+		if code := k.CodeTimeString(time.Unix(v.t, 0)); len(code) != 8 || code != fmt.Sprintf("%08d", v.code) {
+			t.Error("got the wrong code string for", v.algo, "at", v.t, "got:", code)
+			return
+		}
+	}
+}
+
+func TestTotpAccept(t *testing.T) {
+	kt, err := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	at := time.Unix(0, 0).Add(kt.Period * 2)
+	opts := &VerifyOpts{Behind: 1, Ahead: 1}
+	// first use
+	if _, err = kt.Accept("292828", at, opts); err != nil {
+		t.Error(err)
+		return
+	} else if kt.LastStep != 2 {
+		t.Error("last step should be 2, got:", kt.LastStep)
+		return
+	}
+	// replay
+	if _, err = kt.Accept("292828", at, opts); !checkError(err, ECReplayed) {
+		t.Error("got the wrong error")
+		return
+	}
+	// older step
+	if _, err = kt.Accept("848969", at, opts); !checkError(err, ECReplayed) {
+		t.Error("got the wrong error")
+		return
+	}
+	// invalid code
+	if _, err = kt.Accept("000000", at, opts); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+	// next step is fine
+	if ofs, err := kt.Accept(kt.CodePeriodString(3), at, opts); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != 1 || kt.LastStep != 3 {
+		t.Error("wrong offset or last step:", ofs, kt.LastStep)
+		return
+	}
+}
+
+func TestTotpAcceptT0(t *testing.T) {
+	kt, err := ImportTotp("otpauth://totp/a?secret=ADS2OR6Q6K3OJZDW&t0=1000")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// step 0
+	at := time.Unix(1010, 0)
+	code := kt.CodeTimeString(at)
+	if _, err = kt.Accept(code, at, nil); err != nil {
+		t.Error(err)
+		return
+	} else if !kt.Used || kt.LastStep != 0 {
+		t.Error("wrong last step:", kt.Used, kt.LastStep)
+		return
+	}
+	if _, err = kt.Accept(code, at, nil); !checkError(err, ECReplayed) {
+		t.Error("step 0 should be replayed, got:", err)
+		return
+	}
+	// negative steps, before t0
+	kt, _ = ImportTotp("otpauth://totp/a?secret=ADS2OR6Q6K3OJZDW&t0=1000")
+	at = time.Unix(900, 0)
+	code = kt.CodeTimeString(at)
+	if _, err = kt.Accept(code, at, nil); err != nil {
+		t.Error(err)
+		return
+	} else if kt.LastStep != -4 {
+		t.Error("last step should be -4, got:", kt.LastStep)
+		return
+	}
+	if _, err = kt.Accept(code, at, nil); !checkError(err, ECReplayed) {
+		t.Error("step -4 should be replayed, got:", err)
+		return
+	}
+	if _, err = kt.Accept(kt.CodePeriodString(-5), at, &VerifyOpts{Behind: 1}); !checkError(err, ECReplayed) {
+		t.Error("step -5 should be replayed, got:", err)
+		return
+	}
+}
+
+func TestTotpDrift(t *testing.T) {
+	kt, err := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	opts := &VerifyOpts{Behind: 1, Ahead: 1}
+	// the client is 1 period ahead
+	if ofs, err := kt.Accept(kt.CodePeriodString(11), time.Unix(0, 0).Add(kt.Period*10), opts); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != 1 || kt.Drift != 1 {
+		t.Error("wrong offset or drift:", ofs, kt.Drift)
+		return
+	}
+	// 2 periods ahead is within the window, now shifted by the drift
+	if ofs, err := kt.Accept(kt.CodePeriodString(22), time.Unix(0, 0).Add(kt.Period*20), opts); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != 2 || kt.Drift != 2 {
+		t.Error("wrong offset or drift:", ofs, kt.Drift)
+		return
+	}
+	// without drift it's out of the window
+	kt.Drift = 0
+	if _, err = kt.Verify(kt.CodePeriodString(32), time.Unix(0, 0).Add(kt.Period*30), opts); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+	// repeated matches at the edge of the window stop at MaxDrift
+	kt.Drift = 0
+	opts = &VerifyOpts{Behind: 1, Ahead: 1, MaxDrift: 3}
+	for i, want := range []int{1, 2, 3, 3, 3} {
+		step := 100 + i*10
+		if ofs, err := kt.Accept(kt.CodePeriodString(step+kt.Drift+1), time.Unix(0, 0).Add(kt.Period*time.Duration(step)), opts); err != nil {
+			t.Error(err)
+			return
+		} else if kt.Drift != want || ofs > want+1 {
+			t.Error("wrong offset or drift:", ofs, kt.Drift, "expected drift:", want)
+			return
+		}
+	}
+	for i, want := range []int{2, 1, 0, -1, -2, -3, -3} {
+		step := 200 + i*10
+		if _, err = kt.Accept(kt.CodePeriodString(step+kt.Drift-1), time.Unix(0, 0).Add(kt.Period*time.Duration(step)), opts); err != nil {
+			t.Error(err)
+			return
+		} else if kt.Drift != want {
+			t.Error("wrong drift:", kt.Drift, "expected:", want)
+			return
+		}
+	}
+}
+
+func TestTotpT0Period(t *testing.T) {
+	kt, err := ImportTotp("otpauth://totp/mydomain.com?period=0.5&secret=ADS2OR6Q6K3OJZDW&t0=1000")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if kt.Period != 500*time.Millisecond || !kt.T0.Equal(time.Unix(1000, 0)) {
+		t.Error("wrong period or t0:", kt.Period, kt.T0)
+		return
+	}
+	// periods are counted from t0
+	if kt.CodeTime(time.Unix(1001, 0)) != kt.CodePeriod(2) {
+		t.Error("got the wrong code")
+		return
+	}
+	if kt.CodeTime(time.Unix(1001, 700000000)) != kt.CodePeriod(3) {
+		t.Error("got the wrong code")
+		return
+	}
+	// before t0 rounds down
+	if kt.CodeTime(time.Unix(999, 800000000)) != kt.CodePeriod(-1) {
+		t.Error("got the wrong code")
+		return
+	}
+	// period and t0 survive the round trip
+	if u := kt.Url(); u != "otpauth://totp/mydomain.com?period=0.5&secret=ADS2OR6Q6K3OJZDW&t0=1000" {
+		t.Error("got a different url:", u)
+		return
+	}
+	// bad parameters
+	for _, bu := range []struct {
+		u  string
+		ec ErrorCode
+	}{
+		{"otpauth://totp/mydomain.com?period=0&secret=ADS2OR6Q6K3OJZDW", ECInvalidPeriod},
+		{"otpauth://totp/mydomain.com?period=-30&secret=ADS2OR6Q6K3OJZDW", ECInvalidPeriod},
+		{"otpauth://totp/mydomain.com?period=0.00000003&secret=ADS2OR6Q6K3OJZDW", ECInvalidPeriod},
+		{"otpauth://totp/mydomain.com?t0=asd&secret=ADS2OR6Q6K3OJZDW", ECInvalidT0},
+	} {
+		if _, err = ImportTotp(bu.u); !checkError(err, bu.ec) {
+			t.Error("got the wrong error for", bu.u)
+			return
+		}
+	}
+	// zero period defaults to 30 seconds
+	kt = &Totp{Common: kt.Common}
+	if kt.CodeTime(time.Unix(60, 0)) != kt.CodePeriod(2) {
+		t.Error("got the wrong code")
+		return
+	}
 }
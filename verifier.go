@@ -0,0 +1,122 @@
+package otp
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// State is the verification state of a key, as kept in a Store.
+type State struct {
+	// HOTP counter.
+	Counter int `json:"counter,omitempty"`
+	// Last accepted TOTP time step, only meaningful if Used.
+	LastStep int `json:"last_step,omitempty"`
+	// A TOTP time step was accepted.
+	Used bool `json:"used,omitempty"`
+	// TOTP clock drift, in periods.
+	Drift int `json:"drift,omitempty"`
+	// Consecutive failed attempts, counted by Limiter.
+	Failures int `json:"failures,omitempty"`
+	// Time until the key is locked out by Limiter.
+	LockedUntil time.Time `json:"locked_until,omitzero"`
+}
+
+// prefix of the store ids holding State
+const statePrefix = "state:"
+
+// LoadState returns the state for id and its version. A missing state returns nil.
+func LoadState(s Store, id string) (*State, uint64, error) {
+	b, ver, err := s.Load(statePrefix + id)
+	if err != nil || b == nil {
+		return nil, ver, err
+	}
+	st := &State{}
+	if err = json.Unmarshal(b, st); err != nil {
+		return nil, 0, &Error{ECStore, fmt.Sprintf("can't decode state: %v", err), err}
+	}
+	return st, ver, nil
+}
+
+// SwapState stores st for id if the current version is version, and reports whether it did.
+func SwapState(s Store, id string, version uint64, st *State) (bool, error) {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return false, &Error{ECStore, fmt.Sprintf("can't encode state: %v", err), err}
+	}
+	return s.CompareAndSwap(statePrefix+id, version, b)
+}
+
+// Verifier verifies codes and keeps the state of the keys in a Store,
+// so that counters and used time steps are shared by every request and process.
+type Verifier struct {
+	// Store for the state of the keys.
+	Store Store
+	// Window of accepted steps. HOTP keys only use Ahead.
+	Opts *VerifyOpts
+	// Clock used to verify TOTP codes. nil, defaults to the key's clock.
+	Clock Clock
+}
+
+// NewVerifier creates a *Verifier.
+func NewVerifier(s Store, opts *VerifyOpts) *Verifier { return &Verifier{Store: s, Opts: opts} }
+
+// Verify checks code for the key k, stored under id. On success the state is
+// updated: the HOTP counter is advanced, the TOTP time step is marked as used
+// and the TOTP clock drift is recorded, to be applied on the next verification.
+// k is updated with the new state. It returns the offset of the matching step.
+func (v *Verifier) Verify(id string, k Key, code string) (int, error) {
+	for {
+		st, ver, err := LoadState(v.Store, id)
+		if err != nil {
+			return 0, err
+		}
+		// work on a copy of the key, with the stored state
+		var ofs int
+		switch kk := k.(type) {
+		case *Hotp:
+			h := *kk
+			if st == nil {
+				st = &State{Counter: h.Counter}
+			}
+			h.Counter = st.Counter
+			ahead := 0
+			if v.Opts != nil {
+				ahead = v.Opts.Ahead
+			}
+			if ofs, err = h.Accept(code, ahead); err != nil {
+				return 0, err
+			}
+			st.Counter = h.Counter
+		case *Totp:
+			t := *kk
+			if st == nil {
+				st = &State{}
+			}
+			t.LastStep, t.Used, t.Drift = st.LastStep, st.Used, st.Drift
+			now := t.now()
+			if v.Clock != nil {
+				now = v.Clock.Now()
+			}
+			if ofs, err = t.Accept(code, now, v.Opts); err != nil {
+				return 0, err
+			}
+			st.LastStep, st.Used, st.Drift = t.LastStep, t.Used, t.Drift
+		default:
+			return 0, &Error{ECInvalidOtpType, fmt.Sprintf("invalid OTP authentication type: %v", k.Type()), nil}
+		}
+		// try again if someone else changed the state
+		if ok, err := SwapState(v.Store, id, ver, st); err != nil {
+			return 0, err
+		} else if !ok {
+			continue
+		}
+		switch kk := k.(type) {
+		case *Hotp:
+			kk.Counter = st.Counter
+		case *Totp:
+			kk.LastStep, kk.Used, kk.Drift = st.LastStep, st.Used, st.Drift
+		}
+		return ofs, nil
+	}
+}
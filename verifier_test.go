@@ -0,0 +1,82 @@
+package otp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifier(t *testing.T) {
+	s := NewMemoryStore()
+	v := NewVerifier(s, &VerifyOpts{Behind: 1, Ahead: 3})
+	kh, err := ImportHotp("otpauth://hotp/myKey?counter=0&secret=5STMOV5AVXA2IYVU")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// hotp counter is advanced and stored
+	if ofs, err := v.Verify("hotp", kh, "801920"); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != 1 || kh.Counter != 2 {
+		t.Error("wrong offset or counter:", ofs, kh.Counter)
+		return
+	}
+	if st, _, err := LoadState(s, "hotp"); err != nil {
+		t.Error(err)
+		return
+	} else if st.Counter != 2 {
+		t.Error("stored counter should be 2, got:", st.Counter)
+		return
+	}
+	// a fresh copy of the key uses the stored counter
+	kh2, _ := ImportHotp("otpauth://hotp/myKey?counter=0&secret=5STMOV5AVXA2IYVU")
+	if _, err = v.Verify("hotp", kh2, "801920"); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+	if _, err = v.Verify("hotp", kh2, "311346"); err != nil {
+		t.Error(err)
+		return
+	}
+	// totp step is marked as used
+	kt, err := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	v.Clock = NewFakeClock(time.Unix(0, 0).Add(kt.Period * 2))
+	if _, err = v.Verify("totp", kt, "292828"); err != nil {
+		t.Error(err)
+		return
+	}
+	kt2, _ := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if _, err = v.Verify("totp", kt2, "292828"); !checkError(err, ECReplayed) {
+		t.Error("got the wrong error")
+		return
+	}
+	// drift is stored and applied
+	if _, err = v.Verify("totp", kt2, kt2.CodePeriodString(3)); err != nil {
+		t.Error(err)
+		return
+	}
+	if st, _, err := LoadState(s, "totp"); err != nil {
+		t.Error(err)
+		return
+	} else if st.Drift != 1 || st.LastStep != 3 {
+		t.Error("wrong drift or last step:", st.Drift, st.LastStep)
+		return
+	}
+	// step 0, with t0, is stored as used
+	kt3, _ := ImportTotp("otpauth://totp/a?secret=ADS2OR6Q6K3OJZDW&t0=1000")
+	v.Clock = NewFakeClock(time.Unix(1010, 0))
+	code := kt3.CodeTimeString(time.Unix(1010, 0))
+	if _, err = v.Verify("t0", kt3, code); err != nil {
+		t.Error(err)
+		return
+	}
+	kt3, _ = ImportTotp("otpauth://totp/a?secret=ADS2OR6Q6K3OJZDW&t0=1000")
+	if _, err = v.Verify("t0", kt3, code); !checkError(err, ECReplayed) {
+		t.Error("step 0 should be replayed, got:", err)
+		return
+	}
+}
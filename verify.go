@@ -0,0 +1,58 @@
+package otp
+
+import "crypto/subtle"
+
+// VerifyOpts configures the window of steps (periods or counters) accepted by Verify.
+// A nil *VerifyOpts only accepts the current step.
+type VerifyOpts struct {
+	// Number of steps before the current one that are accepted.
+	Behind int
+	// Number of steps after the current one that are accepted.
+	Ahead int
+	// Largest TOTP clock drift, in steps either way, recorded by Accept. <= 0, defaults to DefaultMaxDrift.
+	MaxDrift int
+}
+
+// maxDrift returns the largest drift, or the default.
+func (o *VerifyOpts) maxDrift() int {
+	if o == nil || o.MaxDrift <= 0 {
+		return DefaultMaxDrift
+	}
+	return o.MaxDrift
+}
+
+// window returns the bounds of the window, relative to the current step.
+func (o *VerifyOpts) window() (from, to int) {
+	if o == nil {
+		return 0, 0
+	}
+	if o.Behind > 0 {
+		from = -o.Behind
+	}
+	if o.Ahead > 0 {
+		to = o.Ahead
+	}
+	return
+}
+
+// verifyWindow compares code with the code of every step in the window around step,
+// in constant time, and returns the offset of the matching step.
+// Spaces and dashes in code are ignored.
+func verifyWindow(code string, step int, opts *VerifyOpts, gen func(int) string) (int, error) {
+	code = normalizeCode(code)
+	from, to := opts.window()
+	var (
+		match = 0
+		ofs   = 0
+	)
+	for i := from; i <= to; i++ {
+		// don't stop at the first match, every step takes the same time
+		if subtle.ConstantTimeCompare([]byte(code), []byte(gen(step+i))) == 1 && match == 0 {
+			match, ofs = 1, i
+		}
+	}
+	if match == 0 {
+		return 0, &Error{ECInvalidCode, "invalid code", nil}
+	}
+	return ofs, nil
+}
@@ -0,0 +1,92 @@
+package otp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	kh, err := ImportHotp("otpauth://hotp/myKey?counter=0&secret=5STMOV5AVXA2IYVU")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// exact match only
+	if ofs, err := kh.Verify("100502", nil); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != 0 {
+		t.Error("offset should be 0")
+		return
+	}
+	if _, err = kh.Verify("801920", nil); err == nil {
+		t.Error("an error was expected")
+		return
+	} else if !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+	// look-ahead
+	if ofs, err := kh.Verify("222375", &VerifyOpts{Ahead: 5}); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != 4 {
+		t.Error("offset should be 4, got:", ofs)
+		return
+	}
+	// look-behind
+	kh.Counter = 3
+	if ofs, err := kh.Verify("801920", &VerifyOpts{Behind: 2}); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != -2 {
+		t.Error("offset should be -2, got:", ofs)
+		return
+	}
+	if _, err = kh.Verify("100502", &VerifyOpts{Behind: 2}); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+
+	kt, err := ImportTotp("otpauth://totp/mydomain.com?secret=ADS2OR6Q6K3OJZDW")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	at := time.Unix(0, 0).Add(kt.Period * 2)
+	if ofs, err := kt.Verify("292828", at, nil); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != 0 {
+		t.Error("offset should be 0")
+		return
+	}
+	if ofs, err := kt.Verify("848969", at, &VerifyOpts{Behind: 1, Ahead: 1}); err != nil {
+		t.Error(err)
+		return
+	} else if ofs != -1 {
+		t.Error("offset should be -1, got:", ofs)
+		return
+	}
+	if _, err = kt.Verify("848969", at, &VerifyOpts{Ahead: 1}); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+	// codes with leading zeros
+	kt = &Totp{Common: &Common{Key: []byte("12345678901234567890"), AccountName: "rfc6238", Digits: 8}, Period: DefaultPeriod}
+	if _, err = kt.Verify("07081804", time.Unix(1111111109, 0), nil); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = kt.Verify("7081804", time.Unix(1111111109, 0), nil); !checkError(err, ECInvalidCode) {
+		t.Error("got the wrong error")
+		return
+	}
+	// spaces and dashes are ignored
+	for _, c := range []string{"0708 1804", "0708-1804", " 07081804\n", "07 08 18 04"} {
+		if _, err = kt.Verify(c, time.Unix(1111111109, 0), nil); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}